@@ -0,0 +1,84 @@
+// Command blobmigrate copies uploaded files from one blob store backend to
+// another, for example when moving from local disk to S3:
+//
+//	FORUM_S3_ENDPOINT=http://localhost:9000 FORUM_S3_BUCKET=forum \
+//	FORUM_S3_ACCESS_KEY=... FORUM_S3_SECRET_KEY=... \
+//	go run ./cmd/blobmigrate -from local -to s3
+//
+// Both stores are configured from the same environment variables as the
+// server. Blobs already present in the target are skipped, so an
+// interrupted migration can simply be run again.
+package main
+
+import (
+	"flag"
+	"forum/internal/config"
+	"forum/internal/repository"
+	"log"
+	"mime"
+	"path"
+)
+
+func main() {
+	from := flag.String("from", "local", "backend to copy from (local or s3)")
+	to := flag.String("to", "s3", "backend to copy to (local or s3)")
+	remove := flag.Bool("delete", false, "delete blobs from the source once copied")
+	flag.Parse()
+
+	if *from == *to {
+		log.Fatal("source and target backend are the same")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := openStore(cfg.Blob, *from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	target, err := openStore(cfg.Blob, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := source.List()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var copied, skipped int
+	for _, key := range keys {
+		exists, err := target.Exists(key)
+		if err != nil {
+			log.Fatalf("%s: %v", key, err)
+		}
+
+		if exists {
+			skipped++
+		} else {
+			data, err := source.Get(key)
+			if err != nil {
+				log.Fatalf("%s: %v", key, err)
+			}
+			if err = target.Put(key, mime.TypeByExtension(path.Ext(key)), data); err != nil {
+				log.Fatalf("%s: %v", key, err)
+			}
+			copied++
+		}
+
+		if *remove {
+			if err = source.Delete(key); err != nil {
+				log.Fatalf("%s: %v", key, err)
+			}
+		}
+	}
+
+	log.Printf("copied %d blobs, %d already present", copied, skipped)
+}
+
+func openStore(cfg config.Blob, backend string) (repository.BlobStore, error) {
+	cfg.Backend = backend
+	return repository.NewBlobStore(cfg)
+}
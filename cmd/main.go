@@ -1,11 +1,14 @@
 package main
 
 import (
+	"forum/internal/config"
 	"forum/internal/controller"
 	"forum/internal/repository"
 	"log"
 	"net/http"
 	"time"
+	// Users pick their own timezone; the alpine image has no zoneinfo.
+	_ "time/tzdata"
 
 	"forum/internal/service.go"
 
@@ -17,6 +20,11 @@ type Server struct {
 }
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	db, err := repository.NewDB()
 	defer db.Close()
 	if err != nil {
@@ -28,8 +36,21 @@ func main() {
 		log.Fatal(err)
 	}
 
-	repos := repository.NewRepository(db)
-	services := service.NewService(repos)
+	blobs, err := repository.NewBlobStore(cfg.Blob)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repos := repository.NewRepository(db, blobs)
+	services := service.NewService(repos, cfg)
+	if err = services.Reputation.ScorePastVotes(); err != nil {
+		log.Fatal(err)
+	}
+	if err = services.Badge.AwardPastBadges(); err != nil {
+		log.Fatal(err)
+	}
+	go services.Trash.PurgeEvery(time.Hour)
+	go services.PostItem.PublishEvery(time.Minute)
 	handler := controller.NewHandler(services)
 
 	router := handler.InitRoutes()
@@ -37,7 +58,7 @@ func main() {
 	srv := new(Server)
 
 	log.Println("Starting the server")
-	if err := srv.Start("8000", router); err != nil {
+	if err := srv.Start(cfg.Port, router); err != nil {
 		log.Fatalf("error server: %v", err)
 	}
 }
@@ -3,7 +3,19 @@ module forum
 go 1.19
 
 require (
-	github.com/mattn/go-sqlite3 v1.14.15 // indirect
+	github.com/alecthomas/chroma/v2 v2.8.0
+	github.com/mattn/go-sqlite3 v1.14.15
+	github.com/microcosm-cc/bluemonday v1.0.25
 	github.com/satori/go.uuid v1.2.0
-	golang.org/x/crypto v0.1.0 // indirect
+	github.com/yuin/goldmark v1.5.6
+	golang.org/x/crypto v0.11.0
+	golang.org/x/image v0.10.0
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/dlclark/regexp2 v1.4.0 // indirect
+	github.com/gorilla/css v1.0.0 // indirect
+	golang.org/x/net v0.12.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
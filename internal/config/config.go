@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings read from the environment. Every setting has
+// a default, so the forum runs without any configuration.
+type Config struct {
+	Port string
+	Blob Blob
+	// AttachmentQuota is the default number of bytes of attachments each
+	// user may upload. Administrators can change it per user.
+	AttachmentQuota int64
+	// TrashRetention is how long deleted posts and comments stay in the
+	// trash before they are removed for good.
+	TrashRetention time.Duration
+	// CommentMaxDepth is how many levels of replies a post page shows.
+	// Deeper replies are reached through "continue this thread" links.
+	CommentMaxDepth int
+	// CommentsPerPage is how many top-level comments a page of comments
+	// holds, with their replies.
+	CommentsPerPage int
+	// Reactions are the emoji users can react with to posts and comments,
+	// in the order they are offered.
+	Reactions []string
+	// Reputation sets how users earn reputation and what it unlocks.
+	Reputation Reputation
+}
+
+// Reputation sets how many points the author of a post or comment gains
+// for each like and loses for each dislike it receives, and how much
+// reputation unlocks privileges.
+type Reputation struct {
+	PostLike       int
+	PostDislike    int
+	CommentLike    int
+	CommentDislike int
+	// DailyCap limits the points a user can gain from likes in one day,
+	// 0 for no limit. Dislikes always count.
+	DailyCap int
+	// CreateTags and EditPosts are the reputation needed to create new
+	// tags and to edit the posts of others.
+	CreateTags int
+	EditPosts  int
+}
+
+// Blob selects where uploaded files are stored.
+type Blob struct {
+	// Backend is "local" or "s3".
+	Backend string
+	// Dir is the directory of the local backend.
+	Dir string
+	// Secret signs download URLs of the local backend. A random secret is
+	// used when it is empty, so links stop working after a restart.
+	Secret string
+	// URLExpiry is how long a download URL stays valid at least.
+	URLExpiry time.Duration
+	S3        S3
+}
+
+// S3 configures an S3-compatible object store such as AWS S3 or MinIO.
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle puts the bucket in the path instead of the host name,
+	// which most self-hosted stores need.
+	PathStyle bool
+}
+
+func Load() (Config, error) {
+	cfg := Config{
+		Port: env("FORUM_PORT", "8000"),
+		Blob: Blob{
+			Backend: env("FORUM_BLOB_BACKEND", "local"),
+			Dir:     env("FORUM_UPLOAD_DIR", "uploads"),
+			Secret:  os.Getenv("FORUM_BLOB_SECRET"),
+			S3: S3{
+				Endpoint:  os.Getenv("FORUM_S3_ENDPOINT"),
+				Region:    env("FORUM_S3_REGION", "us-east-1"),
+				Bucket:    os.Getenv("FORUM_S3_BUCKET"),
+				AccessKey: os.Getenv("FORUM_S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("FORUM_S3_SECRET_KEY"),
+			},
+		},
+	}
+
+	var err error
+	if cfg.Blob.URLExpiry, err = time.ParseDuration(env("FORUM_BLOB_URL_EXPIRY", "1h")); err != nil {
+		return Config{}, fmt.Errorf("config: FORUM_BLOB_URL_EXPIRY: %w", err)
+	}
+	if cfg.Blob.URLExpiry <= 0 {
+		return Config{}, fmt.Errorf("config: FORUM_BLOB_URL_EXPIRY must be positive")
+	}
+
+	quota, err := strconv.ParseInt(env("FORUM_ATTACHMENT_QUOTA_MB", "100"), 10, 64)
+	if err != nil || quota < 0 {
+		return Config{}, fmt.Errorf("config: FORUM_ATTACHMENT_QUOTA_MB must be a number of megabytes")
+	}
+	cfg.AttachmentQuota = quota << 20
+
+	if cfg.TrashRetention, err = time.ParseDuration(env("FORUM_TRASH_RETENTION", "720h")); err != nil {
+		return Config{}, fmt.Errorf("config: FORUM_TRASH_RETENTION: %w", err)
+	}
+	if cfg.TrashRetention <= 0 {
+		return Config{}, fmt.Errorf("config: FORUM_TRASH_RETENTION must be positive")
+	}
+
+	if cfg.CommentMaxDepth, err = strconv.Atoi(env("FORUM_COMMENT_MAX_DEPTH", "5")); err != nil || cfg.CommentMaxDepth < 1 {
+		return Config{}, fmt.Errorf("config: FORUM_COMMENT_MAX_DEPTH must be a positive number")
+	}
+
+	if cfg.CommentsPerPage, err = strconv.Atoi(env("FORUM_COMMENTS_PER_PAGE", "20")); err != nil || cfg.CommentsPerPage < 1 {
+		return Config{}, fmt.Errorf("config: FORUM_COMMENTS_PER_PAGE must be a positive number")
+	}
+
+	if cfg.Reactions, err = parseReactions(env("FORUM_REACTIONS", "👍,🎉,❤️,😕,👀,🚀")); err != nil {
+		return Config{}, err
+	}
+
+	reputation := []struct {
+		key, fallback string
+		value         *int
+	}{
+		{"FORUM_REPUTATION_POST_LIKE", "10", &cfg.Reputation.PostLike},
+		{"FORUM_REPUTATION_POST_DISLIKE", "2", &cfg.Reputation.PostDislike},
+		{"FORUM_REPUTATION_COMMENT_LIKE", "5", &cfg.Reputation.CommentLike},
+		{"FORUM_REPUTATION_COMMENT_DISLIKE", "1", &cfg.Reputation.CommentDislike},
+		{"FORUM_REPUTATION_DAILY_CAP", "200", &cfg.Reputation.DailyCap},
+		{"FORUM_REPUTATION_CREATE_TAGS", "50", &cfg.Reputation.CreateTags},
+		{"FORUM_REPUTATION_EDIT_POSTS", "500", &cfg.Reputation.EditPosts},
+	}
+	for _, setting := range reputation {
+		if *setting.value, err = strconv.Atoi(env(setting.key, setting.fallback)); err != nil || *setting.value < 0 {
+			return Config{}, fmt.Errorf("config: %s must be a number of at least 0", setting.key)
+		}
+	}
+
+	if cfg.Blob.S3.PathStyle, err = strconv.ParseBool(env("FORUM_S3_PATH_STYLE", "true")); err != nil {
+		return Config{}, fmt.Errorf("config: FORUM_S3_PATH_STYLE: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// parseReactions splits the comma-separated list of emoji. The names of
+// likes and dislikes cannot be used.
+func parseReactions(value string) ([]string, error) {
+	var reactions []string
+	seen := make(map[string]bool)
+	for _, emoji := range strings.Split(value, ",") {
+		emoji = strings.TrimSpace(emoji)
+		if emoji == "" || seen[emoji] {
+			continue
+		}
+		if emoji == "like" || emoji == "dislike" || len(emoji) > 32 {
+			return nil, fmt.Errorf("config: FORUM_REACTIONS: invalid reaction %q", emoji)
+		}
+		seen[emoji] = true
+		reactions = append(reactions, emoji)
+	}
+	return reactions, nil
+}
+
+func env(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
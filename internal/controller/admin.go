@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"forum/internal/service.go"
+)
+
+type adminGroupsPage struct {
+	User        models.User
+	Groups      []models.Group
+	Boards      []*models.Category
+	Permissions []models.CategoryPermission
+}
+
+func (h *Handler) adminGroups(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	if !h.services.Permission.IsAdmin(user.ID) {
+		h.errorPage(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tmpl, err := template.ParseFiles("web/template/admin-groups.html")
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		page := &adminGroupsPage{User: user}
+
+		if page.Groups, err = h.services.Permission.GetGroups(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if page.Boards, err = h.services.Category.GetBoards(user.ID); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if page.Permissions, err = h.services.Permission.GetCategoryPermissions(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err = tmpl.Execute(w, page); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	case http.MethodPost:
+		groupID, _ := strconv.Atoi(r.FormValue("group"))
+		categoryID, _ := strconv.Atoi(r.FormValue("category"))
+
+		var err error
+		switch r.FormValue("action") {
+		case "create-group":
+			err = h.services.Permission.CreateGroup(r.FormValue("name"))
+		case "add-member":
+			err = h.services.Permission.AddGroupMember(groupID, r.FormValue("username"))
+		case "remove-member":
+			userID, _ := strconv.Atoi(r.FormValue("user"))
+			err = h.services.Permission.RemoveGroupMember(groupID, userID)
+		case "set-permission":
+			err = h.services.Permission.SetCategoryPermission(models.CategoryPermission{
+				CategoryID:  categoryID,
+				GroupID:     groupID,
+				CanRead:     r.FormValue("read") != "",
+				CanPost:     r.FormValue("post") != "",
+				CanModerate: r.FormValue("moderate") != "",
+			})
+		case "delete-permission":
+			err = h.services.Permission.DeleteCategoryPermission(categoryID, groupID)
+		case "set-qa":
+			err = h.services.Category.SetCategoryQA(categoryID, r.FormValue("qa") != "")
+		default:
+			h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidGroup) || errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrCategoryNotFound) {
+				h.errorPage(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		http.Redirect(w, r, "/admin/groups", http.StatusFound)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
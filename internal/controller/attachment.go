@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+// getAttachment counts a download and redirects to a signed link to the
+// file. Files of hidden posts and of comments in the trash are not found.
+func (h *Handler) getAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/attachment/"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	attachment, err := h.services.Attachment.GetAttachment(id)
+	if err != nil {
+		if errors.Is(err, service.ErrAttachmentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+	if !h.canReadPost(w, attachment.PostID, user.ID) {
+		return
+	}
+
+	url, err := h.services.Attachment.DownloadURL(attachment)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+type adminAttachmentsPage struct {
+	User         models.User
+	AllowedTypes []string
+	DefaultQuota int64
+	Quotas       []models.UserQuota
+}
+
+func (h *Handler) adminAttachments(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	if !h.services.Permission.IsAdmin(user.ID) {
+		h.errorPage(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tmpl, err := template.New("admin-attachments.html").Funcs(template.FuncMap{
+			"bytes": models.HumanBytes,
+		}).ParseFiles("web/template/admin-attachments.html")
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		page := &adminAttachmentsPage{
+			User:         user,
+			DefaultQuota: h.services.Attachment.GetDefaultQuota(),
+		}
+
+		if page.AllowedTypes, err = h.services.Attachment.GetAllowedTypes(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if page.Quotas, err = h.services.Attachment.GetUserQuotas(); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err = tmpl.Execute(w, page); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+	case http.MethodPost:
+		var err error
+		switch r.FormValue("action") {
+		case "allow-type":
+			err = h.services.Attachment.AllowType(r.FormValue("type"))
+		case "disallow-type":
+			err = h.services.Attachment.DisallowType(r.FormValue("type"))
+		case "set-quota":
+			megabytes, convErr := strconv.ParseInt(r.FormValue("megabytes"), 10, 64)
+			if convErr != nil {
+				h.errorPage(w, http.StatusBadRequest, convErr.Error())
+				return
+			}
+			err = h.services.Attachment.SetUserQuota(r.FormValue("username"), megabytes)
+		case "reset-quota":
+			userID, _ := strconv.Atoi(r.FormValue("user"))
+			err = h.services.Attachment.ResetUserQuota(userID)
+		default:
+			h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAttachment) || errors.Is(err, service.ErrUserNotFound) {
+				h.errorPage(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		http.Redirect(w, r, "/admin/attachments", http.StatusFound)
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+type badgesPage struct {
+	User   models.User
+	Badges []models.Badge
+}
+
+type badgePage struct {
+	User    models.User
+	Badge   models.Badge
+	Holders []models.UserBadge
+}
+
+// badges lists all badges on /badges and the holders of one badge on
+// /badges/SLUG.
+func (h *Handler) badges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	slug := strings.Trim(strings.TrimPrefix(r.URL.Path, "/badges"), "/")
+	if slug == "" {
+		badges, err := h.services.Badge.GetBadges()
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		tmpl, err := parseTemplate(user, "web/template/badges.html")
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err = tmpl.Execute(w, badgesPage{User: user, Badges: badges}); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	badge, holders, err := h.services.Badge.GetBadge(slug)
+	if err != nil {
+		if errors.Is(err, service.ErrBadgeNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/badge.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = tmpl.Execute(w, badgePage{User: user, Badge: badge, Holders: holders}); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+type boardPage struct {
+	User   models.User
+	Boards []*models.Category
+	Board  *models.Category
+	Parent *models.Category
+	Post   []models.Post
+	// Filter is "unanswered" when a Q&A board lists only the questions
+	// without an accepted answer.
+	Filter string
+}
+
+func (h *Handler) boardIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tmpl, err := parseTemplate(user, "web/template/boards.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	boards, err := h.services.Category.GetBoards(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := &boardPage{
+		User:   user,
+		Boards: boards,
+	}
+
+	if err = tmpl.Execute(w, page); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) getBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/board/"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tmpl, err := parseTemplate(user, "web/template/board.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	board, err := h.services.Category.GetBoardByID(id, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrCategoryNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := &boardPage{
+		User:  user,
+		Board: board,
+	}
+
+	if board.ParentID != 0 {
+		if page.Parent, err = h.services.Category.GetBoardByID(board.ParentID, user.ID); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if len(board.Subforums) == 0 {
+		if board.QA && r.URL.Query().Get("filter") == "unanswered" {
+			page.Filter = "unanswered"
+			page.Post, err = h.services.PostItem.GetUnansweredPosts(board.Name, user.ID)
+		} else {
+			page.Post, err = h.services.PostItem.GetPostsByCategory(board.Name, user.ID)
+		}
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err = tmpl.Execute(w, page); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
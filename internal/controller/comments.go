@@ -5,43 +5,255 @@ import (
 	"fmt"
 	"forum/internal/models"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"forum/internal/service.go"
 )
 
+// commentView is a comment as the post page renders it. The template of a
+// comment calls itself for the replies and cannot reach the page data, so
+// each view carries what it needs from there.
+type commentView struct {
+	*models.Comment
+	User        models.User
+	CanModerate bool
+	// Accepted is set on the accepted answer to a question, CanAccept for
+	// the author of the question.
+	Accepted  bool
+	CanAccept bool
+	Emojis    []string
+	// Vote is the like or dislike of the user on the comment, if any.
+	Vote string
+	// Thread is the id of the thread the page shows on its own, if any.
+	Thread  int
+	Replies []commentView
+}
+
+func newCommentViews(comments []*models.Comment, page *index) []commentView {
+	var thread int
+	if page.Thread != nil {
+		thread = page.Thread.ID
+	}
+
+	question := page.Post.Question
+	views := make([]commentView, 0, len(comments))
+	for _, comment := range comments {
+		views = append(views, commentView{
+			Comment:     comment,
+			User:        page.User,
+			CanModerate: page.CanModerate,
+			Accepted:    question && comment.ID == page.Post.AcceptedID,
+			CanAccept:   question && page.User.ID != 0 && page.User.ID == page.Post.UserID,
+			Emojis:      page.Emojis,
+			Vote:        page.Votes[comment.ID],
+			Thread:      thread,
+			Replies:     newCommentViews(comment.Replies, page),
+		})
+	}
+	return views
+}
+
+// commentIDs returns the ids of the comments and of all replies below
+// them.
+func commentIDs(comments []*models.Comment) []int {
+	var ids []int
+	for _, comment := range comments {
+		ids = append(ids, comment.ID)
+		ids = append(ids, commentIDs(comment.Replies)...)
+	}
+	return ids
+}
+
+// commentPageView is a page of comments as the post page and the "load
+// more" fragment render it.
+type commentPageView struct {
+	PostID   int
+	Sort     string
+	Comments []commentView
+	// Prev and Next are the numbers of the pages before and after, 0 if
+	// there are none.
+	Prev, Next int
+}
+
+func newCommentPageView(comments models.CommentPage, postID int, page *index) *commentPageView {
+	view := &commentPageView{
+		PostID:   postID,
+		Sort:     comments.Sort,
+		Comments: newCommentViews(comments.Comments, page),
+	}
+	if comments.Page > 1 {
+		view.Prev = comments.Page - 1
+	}
+	if comments.Page < comments.Pages {
+		view.Next = comments.Page + 1
+	}
+	return view
+}
+
+// commentFragment serves a page of the comments of a post as an HTML
+// fragment, for the "load more" link of the post page.
+func (h *Handler) commentFragment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/comments/"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	post, err := h.services.PostItem.GetPostByID(postID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	comments, err := h.services.Comment.GetComments(postID, r.URL.Query().Get("sort"), page)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/get-post.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	index := &index{
+		User:        user,
+		Post:        &post,
+		CanModerate: h.services.Permission.CanModeratePost(user.ID, post.Category),
+		Emojis:      h.services.Reaction.Emojis(),
+	}
+	if index.Votes, err = h.services.Reaction.GetVotes(user.ID, models.TargetComment, commentIDs(comments.Comments)); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err = tmpl.ExecuteTemplate(w, "comment-page", newCommentPageView(comments, postID, index)); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// redirectToComment sends permalinks of comments to the page of comments
+// or the thread that shows them.
+func (h *Handler) redirectToComment(w http.ResponseWriter, r *http.Request, postID int, comment string) {
+	commentID, err := strconv.Atoi(comment)
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	order := r.URL.Query().Get("sort")
+	page, thread, err := h.services.Comment.LocateComment(postID, commentID, order)
+	if err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if thread != 0 {
+		http.Redirect(w, r, fmt.Sprintf("/get-post/%d?thread=%d#c%d", postID, thread, commentID), http.StatusFound)
+		return
+	}
+
+	target := url.Values{}
+	if order != "" {
+		target.Set("sort", order)
+	}
+	if page > 1 {
+		target.Set("page", strconv.Itoa(page))
+	}
+	location := fmt.Sprintf("/get-post/%d", postID)
+	if len(target) > 0 {
+		location += "?" + target.Encode()
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s#c%d", location, commentID), http.StatusFound)
+}
+
 func (h *Handler) createComment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
 		return
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxCommentUpload)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		h.errorPage(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
 	postID, err := strconv.Atoi(r.FormValue("postid"))
 	if err != nil {
 		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
 		return
 	}
 
-	author := r.FormValue("author")
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	if !h.canReadPost(w, postID, user.ID) {
+		return
+	}
+
+	files, err := readFiles(r, "attachments", service.MaxAttachmentSize)
+	if err != nil {
+		h.errorPage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	input := r.FormValue("input")
 
+	var parentID int
+	if parent := r.FormValue("parentid"); parent != "" {
+		if parentID, err = strconv.Atoi(parent); err != nil {
+			h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+			return
+		}
+	}
+
 	comment := &models.Comment{
-		Author: author,
-		Text:   input,
-		PostID: postID,
+		Author:   user.Username,
+		UserID:   user.ID,
+		Text:     input,
+		PostID:   postID,
+		ParentID: parentID,
 	}
 
-	if err := h.services.CreateComment(comment); err != nil {
-		if errors.Is(err, service.ErrInvalidComment) {
+	if err := h.services.CreateComment(comment, files); err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrInvalidComment) || errors.Is(err, service.ErrInvalidAttachment) {
 			h.errorPage(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		if errors.Is(err, service.ErrQuotaExceeded) {
+			h.errorPage(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/get-post/%d", postID), 302)
+	if thread, err := strconv.Atoi(r.FormValue("thread")); err == nil {
+		http.Redirect(w, r, fmt.Sprintf("/get-post/%d?thread=%d#c%d", postID, thread, comment.ID), 302)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/get-post/%d?comment=%d", postID, comment.ID), 302)
 }
 
 func (h *Handler) likeComment(w http.ResponseWriter, r *http.Request) {
@@ -56,16 +268,23 @@ func (h *Handler) likeComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userRaw := r.Context().Value(ctxKeyUser)
-	username := userRaw.(models.User)
+	user := r.Context().Value(ctxKeyUser).(models.User)
 
 	comment, err := h.services.GetCommentByID(commentID)
 	if err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = h.services.Comment.LikeComment(commentID, username.Username)
+	if !h.canReadPost(w, comment.PostID, user.ID) {
+		return
+	}
+
+	err = h.services.Comment.LikeComment(commentID, user.ID)
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
@@ -86,16 +305,23 @@ func (h *Handler) disLikeComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userRaw := r.Context().Value(ctxKeyUser)
-	username := userRaw.(models.User)
+	user := r.Context().Value(ctxKeyUser).(models.User)
 
 	comment, err := h.services.GetCommentByID(commentID)
 	if err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	err = h.services.Comment.DislikeComment(commentID, username.Username)
+	if !h.canReadPost(w, comment.PostID, user.ID) {
+		return
+	}
+
+	err = h.services.Comment.DislikeComment(commentID, user.ID)
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
@@ -103,3 +329,205 @@ func (h *Handler) disLikeComment(w http.ResponseWriter, r *http.Request) {
 
 	http.Redirect(w, r, fmt.Sprintf("/get-post/%v", comment.PostID), 302)
 }
+
+func (h *Handler) deleteComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	comment, err := h.services.GetCommentByID(commentID)
+	if err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.canReadPost(w, comment.PostID, user.ID) {
+		return
+	}
+
+	if err = h.services.Comment.DeleteComment(commentID, user.ID, r.FormValue("reason")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrInvalidComment):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/get-post/%d", comment.PostID), 302)
+}
+
+// acceptAnswer lets the author of a question accept a comment as its
+// answer. An empty comment id clears the accepted answer.
+func (h *Handler) acceptAnswer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("postid"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var commentID int
+	if id := r.FormValue("id"); id != "" {
+		if commentID, err = strconv.Atoi(id); err != nil {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	if !h.canReadPost(w, postID, user.ID) {
+		return
+	}
+
+	if err = h.services.Comment.AcceptAnswer(postID, commentID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPostNotFound), errors.Is(err, service.ErrCommentNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrInvalidComment):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if commentID == 0 {
+		http.Redirect(w, r, fmt.Sprintf("/get-post/%d", postID), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/get-post/%d?comment=%d", postID, commentID), http.StatusFound)
+}
+
+// editComment replaces the text of a comment. Authors may edit their own
+// comments, moderators any comment on the posts they moderate.
+func (h *Handler) editComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	comment, err := h.services.GetCommentByID(commentID)
+	if err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.canReadPost(w, comment.PostID, user.ID) {
+		return
+	}
+
+	if err = h.services.Comment.UpdateComment(commentID, user.ID, r.FormValue("input"), r.FormValue("reason")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrInvalidComment):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if thread, err := strconv.Atoi(r.FormValue("thread")); err == nil {
+		http.Redirect(w, r, fmt.Sprintf("/get-post/%d?thread=%d#c%d", comment.PostID, thread, commentID), 302)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/get-post/%d?comment=%d", comment.PostID, commentID), 302)
+}
+
+type commentHistoryPage struct {
+	User      models.User
+	Post      models.Post
+	Comment   models.Comment
+	Revisions []models.CommentRevision
+}
+
+// commentHistory lists the revisions of a comment, each with what it
+// changed.
+func (h *Handler) commentHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	commentID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/comment-history/"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	comment, err := h.services.GetCommentByID(commentID)
+	if err != nil {
+		if errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	post, err := h.services.PostItem.GetPostByID(comment.PostID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	revisions, err := h.services.Comment.GetCommentRevisions(commentID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/comment-history.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := commentHistoryPage{User: user, Post: post, Comment: comment, Revisions: revisions}
+	if err = tmpl.Execute(w, page); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+
+	"forum/internal/service.go"
+)
+
+type draftsPage struct {
+	User  models.User
+	Posts []models.Post
+}
+
+// drafts lists the drafts and scheduled posts of the user, who can
+// publish, schedule or unschedule them from there.
+func (h *Handler) drafts(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		publishAt, err := parsePublishAt(r)
+		if err != nil {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err = h.services.PostItem.SetPostStatus(id, user.ID, r.FormValue("status"), publishAt); err != nil {
+			switch {
+			case errors.Is(err, service.ErrPostNotFound):
+				h.errorPage(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, service.ErrPermissionDenied):
+				h.errorPage(w, http.StatusForbidden, err.Error())
+			case errors.Is(err, service.ErrInvalidPost), errors.Is(err, service.ErrInvalidSchedule):
+				h.errorPage(w, http.StatusBadRequest, err.Error())
+			default:
+				h.errorPage(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		http.Redirect(w, r, "/drafts", http.StatusFound)
+		return
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/drafts.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	posts, err := h.services.PostItem.GetDrafts(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = tmpl.Execute(w, draftsPage{User: user, Posts: posts}); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
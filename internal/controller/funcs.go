@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"forum/internal/models"
+	"html/template"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+// dateLayout is how absolute times are shown on the forum.
+const dateLayout = "2 Jan 2006 15:04 MST"
+
+// templateFuncs are the functions pages use to show times and link users.
+// For times, "ago" gives a relative time such as "3 hours ago", "datetime"
+// the absolute time in the timezone of the user and "isotime" the time for
+// the datetime attribute of <time>. Zero times, which stand for unknown
+// times, are shown as "". "profile" gives the path of the profile page of
+// a username.
+func templateFuncs(user models.User) template.FuncMap {
+	loc := user.Location()
+	return template.FuncMap{
+		"ago": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return relativeTime(t, time.Now())
+		},
+		"datetime": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.In(loc).Format(dateLayout)
+		},
+		"isotime": func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.UTC().Format(time.RFC3339)
+		},
+		"profile": func(username string) string {
+			return "/u/" + url.PathEscape(username)
+		},
+	}
+}
+
+// parseTemplate parses a page with the templateFuncs for the user.
+func parseTemplate(user models.User, path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).Funcs(templateFuncs(user)).ParseFiles(path)
+}
+
+// relativeTime describes t as seen from now, in the largest unit that
+// fits: "just now", "5 minutes ago", "in 2 days" and so on.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	if d < time.Minute {
+		return "just now"
+	}
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+
+	var n int
+	var name string
+	for _, unit := range units {
+		if d >= unit.size {
+			n, name = int(d/unit.size), unit.name
+			break
+		}
+	}
+	if n != 1 {
+		name += "s"
+	}
+
+	if future {
+		return fmt.Sprintf("in %d %s", n, name)
+	}
+	return fmt.Sprintf("%d %s ago", n, name)
+}
@@ -18,14 +18,28 @@ func (h *Handler) InitRoutes() *http.ServeMux {
 	router := http.NewServeMux()
 
 	router.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./web/static"))))
+	router.Handle("/uploads/", http.StripPrefix("/uploads/", http.HandlerFunc(h.getUpload)))
+	router.Handle("/blobs/", http.StripPrefix("/blobs/", http.HandlerFunc(h.getBlob)))
 
 	router.HandleFunc("/", h.indexPage)
 
 	router.HandleFunc("/sign-up", h.signUp)
 	router.HandleFunc("/sign-in", h.signIn)
 	router.HandleFunc("/logout", h.authenticateUser(h.LogOut))
+	router.HandleFunc("/settings", h.authenticateUser(h.settings))
+	router.HandleFunc("/u/", h.profile)
+	router.HandleFunc("/notifications", h.authenticateUser(h.notifications))
+	router.HandleFunc("/block", h.authenticateUser(h.blockUser))
 
 	router.HandleFunc("/create-post", h.authenticateUser(h.createPost))
+	router.HandleFunc("/drafts", h.authenticateUser(h.drafts))
+	router.HandleFunc("/boards", h.boardIndex)
+	router.HandleFunc("/board/", h.getBoard)
+
+	router.HandleFunc("/tags", h.tagAutocomplete)
+	router.HandleFunc("/tag/", h.getTag)
+	router.HandleFunc("/tags/merge", h.authenticateUser(h.mergeTags))
+
 	router.HandleFunc("/get-post/", h.getPost)
 	router.HandleFunc("/get-posts-by-category/", h.getPostsByCategory)
 	router.HandleFunc("/get-created-posts/", h.authenticateUser(h.getCreatedPost))
@@ -33,13 +47,31 @@ func (h *Handler) InitRoutes() *http.ServeMux {
 
 	router.HandleFunc("/like/", h.authenticateUser(h.likePost))
 	router.HandleFunc("/dislike/", h.authenticateUser(h.disLikePost))
+	router.HandleFunc("/react", h.authenticateUser(h.react))
+	router.HandleFunc("/reactions/", h.reactions)
+	router.HandleFunc("/badges", h.badges)
+	router.HandleFunc("/badges/", h.badges)
 
+	router.HandleFunc("/comments/", h.commentFragment)
 	router.HandleFunc("/create-comment", h.authenticateUser(h.createComment))
 	router.HandleFunc("/comment-like/", h.authenticateUser(h.likeComment))
 	router.HandleFunc("/comment-dislike/", h.authenticateUser(h.disLikeComment))
+	router.HandleFunc("/delete-comment", h.authenticateUser(h.deleteComment))
+	router.HandleFunc("/edit-comment", h.authenticateUser(h.editComment))
+	router.HandleFunc("/accept-answer", h.authenticateUser(h.acceptAnswer))
+	router.HandleFunc("/comment-history/", h.commentHistory)
 
 	router.HandleFunc("/update-post", h.authenticateUser(h.updatePost))
+	router.HandleFunc("/preview", h.authenticateUser(h.previewMarkdown))
 	router.HandleFunc("/delete", h.authenticateUser(h.deletePost))
+	router.HandleFunc("/post-history/", h.postHistory)
+	router.HandleFunc("/post-rollback", h.authenticateUser(h.rollbackPost))
+	router.HandleFunc("/trash", h.authenticateUser(h.trash))
+
+	router.HandleFunc("/attachment/", h.getAttachment)
+
+	router.HandleFunc("/admin/groups", h.authenticateUser(h.adminGroups))
+	router.HandleFunc("/admin/attachments", h.authenticateUser(h.adminAttachments))
 
 	return router
 }
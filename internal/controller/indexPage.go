@@ -3,12 +3,12 @@ package controller
 import (
 	"forum/internal/models"
 	"net/http"
-	"text/template"
 )
 
 type Index struct {
 	User models.User
 	Post []models.Post
+	Tags []models.Tag
 }
 
 func (h *Handler) indexPage(w http.ResponseWriter, r *http.Request) {
@@ -21,11 +21,21 @@ func (h *Handler) indexPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl := template.Must(template.ParseFiles("web/template/index.html"))
-
 	user := h.services.Authorization.GetSessionTokenFromRequest(r)
 
-	posts, err := h.services.PostItem.GetAllPosts()
+	tmpl, err := parseTemplate(user, "web/template/index.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	posts, err := h.services.PostItem.GetAllPosts(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tags, err := h.services.Tag.GetTagCloud(user.ID)
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
@@ -34,6 +44,7 @@ func (h *Handler) indexPage(w http.ResponseWriter, r *http.Request) {
 	index := &Index{
 		User: user,
 		Post: posts,
+		Tags: tags,
 	}
 
 	if err = tmpl.Execute(w, index); err != nil {
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"net/url"
+
+	"forum/internal/service.go"
+)
+
+type notificationsPage struct {
+	User          models.User
+	Notifications []models.Notification
+}
+
+// notifications lists the latest notifications of the user. Unread ones
+// are highlighted once and marked read by showing them.
+func (h *Handler) notifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	notifications, err := h.services.Notification.GetNotifications(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = h.services.Notification.MarkNotificationsRead(user.ID); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	user.UnreadNotifications = 0
+
+	tmpl, err := parseTemplate(user, "web/template/notifications.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = tmpl.Execute(w, notificationsPage{User: user, Notifications: notifications}); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// blockUser blocks or unblocks the named user and goes back to their
+// profile, or to the settings when the form asks for it.
+func (h *Handler) blockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	username := r.FormValue("username")
+
+	var err error
+	switch r.FormValue("action") {
+	case "block":
+		err = h.services.Notification.BlockUser(user.ID, username)
+	case "unblock":
+		err = h.services.Notification.UnblockUser(user.ID, username)
+	default:
+		h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrInvalidUsername):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if r.FormValue("redirect") == "settings" {
+		http.Redirect(w, r, "/settings", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/u/"+url.PathEscape(username), http.StatusFound)
+}
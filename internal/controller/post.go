@@ -5,18 +5,44 @@ import (
 	"fmt"
 	"forum/internal/models"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"forum/internal/service.go"
 )
 
+const (
+	maxPostUpload    = service.MaxPostImages*service.MaxImageSize + maxCommentUpload
+	maxCommentUpload = service.MaxAttachments*service.MaxAttachmentSize + 1<<20
+	multipartMemory  = 8 << 20
+)
+
 type index struct {
 	User     models.User
 	Post     *models.Post
-	Comments []*models.Comment
+	Comments []commentView
+	// CommentPage is the page of comments a post page shows, unless it
+	// shows a single thread.
+	CommentPage *commentPageView
+	// Thread is the comment whose thread a post page shows on its own.
+	Thread *models.Comment
+	// Answer is the accepted answer a question shows beneath the post.
+	Answer  *models.Comment
+	Storage models.StorageUsage
+	// CanModerate is set on post pages for moderators of the post,
+	// CanEdit for those who may edit it.
+	CanModerate bool
+	CanEdit     bool
+	// Emojis are the emoji users can react with.
+	Emojis []string
+	// Vote is the like or dislike of the user on the post, Votes those on
+	// the comments by comment id.
+	Vote  string
+	Votes map[int]string
 }
 
 func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
@@ -33,9 +59,16 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		post := &models.Post{}
 
+		storage, err := h.services.Attachment.GetStorageUsage(user.ID)
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
 		index := &index{
-			User: user,
-			Post: post,
+			User:    user,
+			Post:    post,
+			Storage: storage,
 		}
 
 		if err = tmpl.Execute(w, index); err != nil {
@@ -43,48 +76,145 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case http.MethodPost:
-		r.ParseForm()
+		r.Body = http.MaxBytesReader(w, r.Body, maxPostUpload)
+		if err = r.ParseMultipartForm(multipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			h.errorPage(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+
+		images, err := readFiles(r, "images", service.MaxImageSize)
+		if err != nil {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		files, err := readFiles(r, "attachments", service.MaxAttachmentSize)
+		if err != nil {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		title := r.FormValue("title")
 		content := r.FormValue("content")
 		about := r.FormValue("about")
 		categoryString := r.Form["category"]
+		tags := r.Form["tags"]
+
+		publishAt, err := parsePublishAt(r)
+		if err != nil {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
 		post := &models.Post{
-			UserID:   user.ID,
-			Title:    title,
-			Content:  content,
-			About:    about,
-			Category: categoryString,
+			UserID:    user.ID,
+			Title:     title,
+			Content:   content,
+			About:     about,
+			Category:  categoryString,
+			Tags:      tags,
+			Status:    r.FormValue("status"),
+			PublishAt: publishAt,
 		}
 
-		if err = h.services.PostItem.CreatePost(post); err != nil {
-			if errors.Is(err, service.ErrInvalidPost) {
+		if err = h.services.PostItem.CreatePost(post, fileData(images), files); err != nil {
+			if errors.Is(err, service.ErrInvalidPost) || errors.Is(err, service.ErrInvalidSchedule) ||
+				errors.Is(err, service.ErrInvalidImage) || errors.Is(err, service.ErrInvalidAttachment) {
 				h.errorPage(w, http.StatusBadRequest, err.Error())
 				return
 			}
+			if errors.Is(err, service.ErrQuotaExceeded) {
+				h.errorPage(w, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			if errors.Is(err, service.ErrPermissionDenied) {
+				h.errorPage(w, http.StatusForbidden, err.Error())
+				return
+			}
 			h.errorPage(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
+		if post.Status != models.PostPublished {
+			http.Redirect(w, r, "/drafts", 302)
+			return
+		}
 		http.Redirect(w, r, "/", 302)
 	default:
 		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
 	}
 }
 
+// parsePublishAt reads the time of a scheduled post from a datetime-local
+// input. Browsers send such times without a zone, so the form also sends
+// the offset of the user's clock as returned by Date.getTimezoneOffset.
+func parsePublishAt(r *http.Request) (time.Time, error) {
+	value := r.FormValue("publish-at")
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	offset, _ := strconv.Atoi(r.FormValue("timezone-offset"))
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, time.FixedZone("", -offset*60))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid publishing time %q", value)
+	}
+	return t, nil
+}
+
+// readFiles returns the files sent in a multipart form field. Empty file
+// inputs are skipped; files are read up to one byte past maxSize, so the
+// service can still tell that they are too large.
+func readFiles(r *http.Request, field string, maxSize int64) ([]service.AttachmentFile, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	var files []service.AttachmentFile
+	for _, header := range r.MultipartForm.File[field] {
+		if header.Size == 0 {
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, service.AttachmentFile{Name: header.Filename, Data: data})
+	}
+	return files, nil
+}
+
+func fileData(files []service.AttachmentFile) [][]byte {
+	data := make([][]byte, 0, len(files))
+	for _, file := range files {
+		data = append(data, file.Data)
+	}
+	return data
+}
+
 func (h *Handler) getPostsByCategory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
 		return
 	}
 
-	tmpl := template.Must(template.ParseFiles("web/template/index.html"))
-
 	user := h.services.Authorization.GetSessionTokenFromRequest(r)
 
+	tmpl, err := parseTemplate(user, "web/template/index.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	category := r.URL.Query().Get("category")
 
-	posts, err := h.services.PostItem.GetPostsByCategory(category)
+	posts, err := h.services.PostItem.GetPostsByCategory(category, user.ID)
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
@@ -107,35 +237,94 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles("web/template/get-post.html")
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tmpl, err := parseTemplate(user, "web/template/get-post.html")
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	user := h.services.Authorization.GetSessionTokenFromRequest(r)
-
 	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/get-post/"))
 	if err != nil {
 		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
 		return
 	}
 
-	post, err := h.services.PostItem.GetPostByID(postID)
+	post, err := h.services.PostItem.GetPostByID(postID, user.ID)
 	if err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	comments, err := h.services.Comment.GetComments(postID)
+	if raw := r.URL.Query().Get("raw"); raw != "" {
+		h.rawCodeBlock(w, post, raw)
+		return
+	}
+
+	index := &index{
+		User:        user,
+		Post:        &post,
+		CanModerate: h.services.Permission.CanModeratePost(user.ID, post.Category),
+		CanEdit:     h.services.PostItem.CanEditPost(user.ID, post),
+		Emojis:      h.services.Reaction.Emojis(),
+	}
+
+	votes, err := h.services.Reaction.GetVotes(user.ID, models.TargetPost, []int{postID})
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	index := &index{
-		User:     user,
-		Post:     &post,
-		Comments: comments,
+	index.Vote = votes[postID]
+
+	query := r.URL.Query()
+	if comment := query.Get("comment"); comment != "" {
+		h.redirectToComment(w, r, postID, comment)
+		return
+	}
+
+	if post.Question && post.AcceptedID != 0 {
+		if index.Answer, err = h.services.Comment.GetCommentThread(postID, post.AcceptedID); err != nil && !errors.Is(err, service.ErrCommentNotFound) {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if thread := query.Get("thread"); thread != "" {
+		commentID, err := strconv.Atoi(thread)
+		if err != nil {
+			h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+			return
+		}
+		if index.Thread, err = h.services.Comment.GetCommentThread(postID, commentID); err != nil {
+			if errors.Is(err, service.ErrCommentNotFound) {
+				h.errorPage(w, http.StatusNotFound, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if index.Votes, err = h.services.Reaction.GetVotes(user.ID, models.TargetComment, commentIDs([]*models.Comment{index.Thread})); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		index.Comments = newCommentViews([]*models.Comment{index.Thread}, index)
+	} else {
+		page, _ := strconv.Atoi(query.Get("page"))
+		comments, err := h.services.Comment.GetComments(postID, query.Get("sort"), page)
+		if err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if index.Votes, err = h.services.Reaction.GetVotes(user.ID, models.TargetComment, commentIDs(comments.Comments)); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		index.CommentPage = newCommentPageView(comments, postID, index)
 	}
 
 	if err = tmpl.Execute(w, index); err != nil {
@@ -143,6 +332,24 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// rawCodeBlock serves the n-th code block of the post as plain text.
+func (h *Handler) rawCodeBlock(w http.ResponseWriter, post models.Post, raw string) {
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	code, err := h.services.Markdown.CodeBlock(post.Content, n)
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, code)
+}
+
 func (h *Handler) getCreatedPost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
@@ -162,7 +369,11 @@ func (h *Handler) getCreatedPost(w http.ResponseWriter, r *http.Request) {
 		Post: posts,
 	}
 
-	tmpl := template.Must(template.ParseFiles("web/template/index.html"))
+	tmpl, err := parseTemplate(user, "web/template/index.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if err = tmpl.Execute(w, index); err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 	}
@@ -177,7 +388,7 @@ func (h *Handler) getLikedPost(w http.ResponseWriter, r *http.Request) {
 	userRaw := r.Context().Value(ctxKeyUser)
 	user := userRaw.(models.User)
 
-	posts, err := h.services.PostItem.GetLikedPosts(user.Username)
+	posts, err := h.services.PostItem.GetLikedPosts(user)
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
@@ -188,7 +399,11 @@ func (h *Handler) getLikedPost(w http.ResponseWriter, r *http.Request) {
 		Post: posts,
 	}
 
-	tmpl := template.Must(template.ParseFiles("web/template/index.html"))
+	tmpl, err := parseTemplate(user, "web/template/index.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	err = tmpl.Execute(w, index)
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
@@ -208,9 +423,12 @@ func (h *Handler) likePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username := r.FormValue("username")
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	if !h.canReadPost(w, id, user.ID) {
+		return
+	}
 
-	if err = h.services.LikePost(username, id); err != nil {
+	if err = h.services.LikePost(user.ID, id); err != nil {
 		log.Println(err)
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
@@ -220,15 +438,23 @@ func (h *Handler) likePost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) disLikePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
 	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/dislike/"))
 	if err != nil {
 		h.errorPage(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	username := r.FormValue("username")
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	if !h.canReadPost(w, id, user.ID) {
+		return
+	}
 
-	if err = h.services.DisLikePost(username, id); err != nil {
+	if err = h.services.DisLikePost(user.ID, id); err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -237,9 +463,10 @@ func (h *Handler) disLikePost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) updatePost(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("web/partials/layout.html", "web/template/editpost.html", "web/template/privat.navbar.html")
+	tmpl, err := template.ParseFiles("web/template/editpost.html")
 	if err != nil {
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	id, err := strconv.Atoi(r.FormValue("id"))
@@ -248,44 +475,107 @@ func (h *Handler) updatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := h.services.PostItem.GetPostByID(id)
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	post, err := h.services.PostItem.GetPostByID(id, user.ID)
 	if err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if !h.services.PostItem.CanEditPost(user.ID, post) {
+		h.errorPage(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return
+	}
+
 	index := &index{
+		User: user,
 		Post: &post,
 	}
 
 	if r.Method == "GET" {
-		tmpl.Execute(w, index)
+		if err = tmpl.Execute(w, index); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
 	title := r.FormValue("title")
 	content := r.FormValue("content")
+	reason := r.FormValue("reason")
 
-	err = h.services.PostItem.UpdatePost(id, post.Like, post.DisLike, title, content)
+	err = h.services.PostItem.UpdatePost(id, user.ID, title, content, reason)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidPost) {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrPermissionDenied) {
+			h.errorPage(w, http.StatusForbidden, err.Error())
+			return
+		}
 		h.errorPage(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	http.Redirect(w, r, "/", 302)
+	http.Redirect(w, r, fmt.Sprintf("/get-post/%d", id), 302)
+}
+
+func (h *Handler) previewMarkdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, h.services.Markdown.Preview(r.FormValue("content")))
 }
 
 func (h *Handler) deletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
 	id, err := strconv.Atoi(r.FormValue("id"))
 	if err != nil {
 		h.errorPage(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	if err = h.services.DeletePost(id); err != nil {
-		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	if err = h.services.PostItem.DeletePost(id, user.ID, r.FormValue("reason")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPostNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrInvalidPost):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
 	http.Redirect(w, r, "/", 302)
 }
+
+// canReadPost renders the not found page and returns false when the post
+// does not exist or is hidden from the user.
+func (h *Handler) canReadPost(w http.ResponseWriter, postID, userID int) bool {
+	if _, err := h.services.PostItem.GetPostByID(postID, userID); err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return false
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+type profilePage struct {
+	User    models.User
+	Profile models.Profile
+	Blocked bool
+}
+
+// profile shows the public profile of the user named in the path.
+func (h *Handler) profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tmpl, err := parseTemplate(user, "web/template/profile.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	profile, err := h.services.Profile.GetProfile(strings.TrimPrefix(r.URL.Path, "/u/"), user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var blocked bool
+	if user.ID != 0 && user.ID != profile.User.ID {
+		if blocked, err = h.services.Notification.IsBlocked(user.ID, profile.User.ID); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err = tmpl.Execute(w, profilePage{User: user, Profile: profile, Blocked: blocked}); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
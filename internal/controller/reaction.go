@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+type reactionsPage struct {
+	User models.User
+	Post models.Post
+	// Comment is set when the page lists the reactions to a comment.
+	Comment   *models.Comment
+	Reactions models.ReactionPage
+	// Prev and Next are the numbers of the pages before and after, 0 if
+	// there are none.
+	Prev, Next int
+}
+
+// reactions lists who reacted to a post or comment in the way chosen with
+// ?kind=, likes by default. The path is /reactions/post/ID or
+// /reactions/comment/ID.
+func (h *Handler) reactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	target, rawID, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/reactions/"), "/")
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+	page := reactionsPage{User: user}
+
+	postID := id
+	switch target {
+	case models.TargetPost:
+	case models.TargetComment:
+		comment, err := h.services.Comment.GetCommentByID(id)
+		if err != nil {
+			if errors.Is(err, service.ErrCommentNotFound) {
+				h.errorPage(w, http.StatusNotFound, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		page.Comment = &comment
+		postID = comment.PostID
+	default:
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if page.Post, err = h.services.PostItem.GetPostByID(postID, user.ID); err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	number, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page.Reactions, err = h.services.Reaction.GetReactionPage(target, id, r.URL.Query().Get("kind"), number, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidReaction) {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if page.Reactions.Page > 1 {
+		page.Prev = page.Reactions.Page - 1
+	}
+	if page.Reactions.Page < page.Reactions.Pages {
+		page.Next = page.Reactions.Page + 1
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/reactions.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = tmpl.Execute(w, page); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// react adds or takes back an emoji reaction of the user to a post or a
+// comment and goes back to it.
+func (h *Handler) react(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	target := r.FormValue("target")
+
+	redirect := fmt.Sprintf("/get-post/%d", id)
+	switch target {
+	case models.TargetPost:
+		if !h.canReadPost(w, id, user.ID) {
+			return
+		}
+	case models.TargetComment:
+		comment, err := h.services.Comment.GetCommentByID(id)
+		if err != nil {
+			if errors.Is(err, service.ErrCommentNotFound) {
+				h.errorPage(w, http.StatusNotFound, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !h.canReadPost(w, comment.PostID, user.ID) {
+			return
+		}
+		redirect = fmt.Sprintf("/get-post/%d?comment=%d", comment.PostID, id)
+	default:
+		h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	// Likes and dislikes go through their own handlers, which keep the
+	// reputation of the author in step.
+	emoji := r.FormValue("emoji")
+	if emoji == models.ReactionLike || emoji == models.ReactionDislike {
+		h.errorPage(w, http.StatusBadRequest, service.ErrInvalidReaction.Error())
+		return
+	}
+
+	if err = h.services.Reaction.ToggleReaction(user.ID, target, id, emoji); err != nil {
+		if errors.Is(err, service.ErrInvalidReaction) {
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+type historyPage struct {
+	User        models.User
+	Post        models.Post
+	Revisions   []models.PostRevision
+	Diff        models.RevisionDiff
+	CanRollback bool
+}
+
+// postHistory lists the revisions of a post and shows the diff between the
+// revisions chosen with ?from= and ?to=, by default the last edit.
+func (h *Handler) postHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	postID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/post-history/"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tmpl, err := parseTemplate(user, "web/template/post-history.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	post, err := h.services.PostItem.GetPostByID(postID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	revisions, err := h.services.Revision.GetRevisions(postID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	to, _ := strconv.Atoi(r.URL.Query().Get("to"))
+
+	diff, err := h.services.Revision.GetRevisionDiff(postID, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrRevisionNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := historyPage{
+		User:        user,
+		Post:        post,
+		Revisions:   revisions,
+		Diff:        diff,
+		CanRollback: h.services.Revision.CanRollback(user.ID, post),
+	}
+
+	if err = tmpl.Execute(w, page); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) rollbackPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	revisionID, err := strconv.Atoi(r.FormValue("revision"))
+	if err != nil {
+		h.errorPage(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	post, err := h.services.PostItem.GetPostByID(postID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrPostNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = h.services.Revision.RollbackPost(post, revisionID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrRevisionNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post-history/%d", postID), http.StatusFound)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"time"
+
+	"forum/internal/service.go"
+)
+
+type settingsPage struct {
+	User    models.User
+	Now     time.Time
+	Blocked []models.User
+}
+
+// settings lets the user choose the timezone times are shown in and
+// whether mentions notify them, and lists the users they blocked.
+func (h *Handler) settings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := h.services.Authorization.SetTimezone(user.ID, r.FormValue("timezone")); err != nil {
+			if errors.Is(err, service.ErrInvalidTimezone) {
+				h.errorPage(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if err := h.services.Authorization.SetNotifyMentions(user.ID, r.FormValue("notify_mentions") != ""); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+		return
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/settings.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	blocked, err := h.services.Notification.GetBlockedUsers(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = tmpl.Execute(w, settingsPage{User: user, Now: time.Now(), Blocked: blocked}); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
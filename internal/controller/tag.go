@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"forum/internal/service.go"
+)
+
+type tagPage struct {
+	User        models.User
+	Tag         models.Tag
+	Post        []models.Post
+	IsModerator bool
+}
+
+type tagSuggestion struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (h *Handler) tagAutocomplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tags, err := h.services.Tag.Autocomplete(r.URL.Query().Get("prefix"), user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	suggestions := make([]tagSuggestion, 0, len(tags))
+	for _, tag := range tags {
+		suggestions = append(suggestions, tagSuggestion{Name: tag.Name, Count: tag.Count})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+func (h *Handler) getTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+
+	tmpl, err := parseTemplate(user, "web/template/tag.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/tag/")
+
+	tag, err := h.services.Tag.GetTag(name)
+	if err != nil {
+		if errors.Is(err, service.ErrTagNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if tag.Name != name {
+		http.Redirect(w, r, "/tag/"+url.PathEscape(tag.Name), http.StatusMovedPermanently)
+		return
+	}
+
+	posts, err := h.services.PostItem.GetPostsByTag(tag.Name, user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := &tagPage{
+		User:        user,
+		Tag:         tag,
+		Post:        posts,
+		IsModerator: h.services.Permission.IsModerator(user.ID),
+	}
+
+	if err = tmpl.Execute(w, page); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *Handler) mergeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	user := r.Context().Value(ctxKeyUser).(models.User)
+
+	from := r.FormValue("from")
+	to := r.FormValue("to")
+
+	if err := h.services.Tag.MergeTags(from, to, user.ID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPermissionDenied):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrTagNotFound), errors.Is(err, service.ErrInvalidTag):
+			h.errorPage(w, http.StatusBadRequest, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/tag/%s", url.PathEscape(to)), http.StatusFound)
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"strconv"
+
+	"forum/internal/service.go"
+)
+
+type trashPage struct {
+	User  models.User
+	Trash models.Trash
+}
+
+// trash lists the deleted posts and comments a moderator may restore.
+func (h *Handler) trash(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(models.User)
+	if !h.services.Permission.IsModerator(user.ID) && !h.services.Permission.IsAdmin(user.ID) {
+		h.errorPage(w, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "restore-post":
+			err = h.services.Trash.RestorePost(id, user.ID)
+		case "restore-comment":
+			err = h.services.Trash.RestoreComment(id, user.ID)
+		default:
+			h.errorPage(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			return
+		}
+
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrPostNotFound), errors.Is(err, service.ErrCommentNotFound):
+				h.errorPage(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, service.ErrPermissionDenied):
+				h.errorPage(w, http.StatusForbidden, err.Error())
+			default:
+				h.errorPage(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		http.Redirect(w, r, "/trash", http.StatusFound)
+		return
+	default:
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	tmpl, err := parseTemplate(user, "web/template/trash.html")
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	trash, err := h.services.Trash.GetTrash(user.ID)
+	if err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err = tmpl.Execute(w, trashPage{User: user, Trash: trash}); err != nil {
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+	}
+}
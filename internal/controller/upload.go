@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forum/internal/repository"
+	"forum/internal/service.go"
+)
+
+// getUpload redirects the stable URL of an uploaded image to a signed,
+// expiring download URL of the blob store. Thumbnails are generated on
+// their first request. Images are served only to users who can read one
+// of the posts showing them.
+func (h *Handler) getUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	postIDs, err := h.services.Image.GetImagePostIDs(r.URL.Path)
+	if err != nil {
+		if errors.Is(err, service.ErrImageNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user := h.services.Authorization.GetSessionTokenFromRequest(r)
+	readable := false
+	for _, postID := range postIDs {
+		if readable, err = h.services.PostItem.CanReadPost(postID, user.ID); err != nil {
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if readable {
+			break
+		}
+	}
+	if !readable {
+		h.errorPage(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	url, err := h.services.Image.ImageURL(r.URL.Path)
+	if err != nil {
+		if errors.Is(err, service.ErrImageNotFound) {
+			h.errorPage(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.errorPage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Signed URLs stay the same for a while, so the redirect can be cached
+	// briefly without handing out an expired link.
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// getBlob serves a file of the local blob store to a signed download URL.
+func (h *Handler) getBlob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.errorPage(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		h.errorPage(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	download := r.URL.Query().Get("download")
+	data, err := h.services.Blob.ReadBlob(r.URL.Path, expires, download, r.URL.Query().Get("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSignature):
+			h.errorPage(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrBlobNotFound):
+			h.errorPage(w, http.StatusNotFound, err.Error())
+		default:
+			h.errorPage(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	maxAge := time.Until(time.Unix(expires, 0)) / time.Second
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if download != "" {
+		w.Header().Set("Content-Disposition", repository.ContentDisposition(download))
+	}
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,52 @@
+package models
+
+import "fmt"
+
+// Attachment is a file uploaded with a post or a comment. CommentID is 0
+// for files attached to the post itself.
+type Attachment struct {
+	ID          int
+	UserID      int
+	PostID      int
+	CommentID   int
+	Name        string
+	Key         string
+	ContentType string
+	Size        int64
+	Downloads   int
+}
+
+// HumanSize formats the size for display, e.g. "1.4 MB".
+func (a Attachment) HumanSize() string {
+	return HumanBytes(a.Size)
+}
+
+// StorageUsage is how much of their attachment quota a user has used.
+type StorageUsage struct {
+	Used  int64
+	Limit int64
+}
+
+func (u StorageUsage) String() string {
+	return fmt.Sprintf("%s of %s used", HumanBytes(u.Used), HumanBytes(u.Limit))
+}
+
+// UserQuota is a quota set by an administrator for one user.
+type UserQuota struct {
+	UserID   int
+	Username string
+	Limit    int64
+}
+
+func HumanBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Domain events the badge rules are evaluated on. UserID is the user the
+// event may earn a badge.
+const (
+	EventPostPublished  = "post-published"
+	EventAnswerAccepted = "answer-accepted"
+	EventVoteReceived   = "vote-received"
+	EventSignedIn       = "signed-in"
+)
+
+// Event is something that happened to a user.
+type Event struct {
+	Kind   string
+	UserID int
+}
+
+// Badge is an achievement users are awarded once. Holders is only filled
+// in on the list of badges.
+type Badge struct {
+	Slug        string
+	Name        string
+	Description string
+	Holders     int
+}
+
+// UserBadge is a badge awarded to a user.
+type UserBadge struct {
+	Badge
+	UserID    int
+	Username  string
+	AwardedAt time.Time
+}
+
+// UserStats are the numbers the badge rules look at.
+type UserStats struct {
+	Posts           int
+	AcceptedAnswers int
+	LikesReceived   int
+	JoinedAt        time.Time
+}
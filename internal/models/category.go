@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type Category struct {
+	ID          int
+	ParentID    int
+	Name        string
+	Description string
+	Position    int
+	// QA turns on the Q&A mode: post authors can accept a comment as the
+	// answer to their question.
+	QA            bool
+	PostCount     int
+	LastPostID    int
+	LastPostTitle string
+	LastPostAt    time.Time
+	Moderators    []User
+	Subforums     []*Category
+}
@@ -1,10 +1,54 @@
 package models
 
+import (
+	"html/template"
+	"time"
+)
+
+// Comment sort orders. Only the top-level comments of a post are sorted;
+// replies stay in the order they were written.
+const (
+	CommentsOldest = "oldest"
+	CommentsNewest = "newest"
+	CommentsBest   = "best"
+)
+
 type Comment struct {
-	ID       int
-	PostID   int
-	Author string
-	Text     string
-	Likes    int
-	DisLikes int
+	ID          int
+	PostID      int
+	ParentID    int
+	PostTitle   string
+	UserID      int
+	Author      string
+	Text        string
+	TextHTML    template.HTML
+	Likes       int
+	DisLikes    int
+	Attachments []Attachment
+	Reactions   []ReactionCount
+	Deleted     *Deletion
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// Replies are the answers to the comment, as far as they are shown.
+	// HiddenReplies counts the replies below the maximum depth, which are
+	// left out.
+	Replies       []*Comment
+	HiddenReplies int
+	// AuthorReputation is the reputation of the author, filled in on post
+	// pages.
+	AuthorReputation int
+}
+
+// IsEdited reports whether the comment was changed after it was written.
+func (c *Comment) IsEdited() bool {
+	return c.UpdatedAt.After(c.CreatedAt)
+}
+
+// CommentPage is one page of the top-level comments of a post, with their
+// replies. Pages count from 1.
+type CommentPage struct {
+	Comments []*Comment
+	Sort     string
+	Page     int
+	Pages    int
 }
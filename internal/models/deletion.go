@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Deletion records who moved a post or comment to the trash, when and why.
+// PurgeAt is when the trash is emptied of it for good.
+type Deletion struct {
+	By      int
+	ByName  string
+	At      time.Time
+	Reason  string
+	PurgeAt time.Time
+}
+
+// Trash holds the deleted posts and comments a moderator may restore.
+type Trash struct {
+	Posts    []Post
+	Comments []*Comment
+}
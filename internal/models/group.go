@@ -0,0 +1,17 @@
+package models
+
+type Group struct {
+	ID      int
+	Name    string
+	Members []User
+}
+
+type CategoryPermission struct {
+	CategoryID   int
+	CategoryName string
+	GroupID      int
+	GroupName    string
+	CanRead      bool
+	CanPost      bool
+	CanModerate  bool
+}
@@ -0,0 +1,16 @@
+package models
+
+// Image is a picture uploaded with a post. Filename is the content hash of
+// the re-encoded file plus its extension. Srcset and Preview point at the
+// generated thumbnails.
+type Image struct {
+	ID          int
+	PostID      int
+	Filename    string
+	ContentType string
+	Width       int
+	Height      int
+	Size        int
+	Srcset      string
+	Preview     string
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Notification kinds.
+const (
+	NotificationMention = "mention"
+)
+
+// Notification tells a user about something another user did, such as
+// mentioning them. CommentID is 0 for notifications about a post itself.
+type Notification struct {
+	ID        int
+	UserID    int
+	ActorID   int
+	Actor     string
+	Kind      string
+	PostID    int
+	PostTitle string
+	CommentID int
+	CreatedAt time.Time
+	Read      bool
+}
@@ -1,17 +1,59 @@
 package models
 
+import (
+	"html/template"
+	"time"
+)
+
+// Post statuses. Drafts and scheduled posts are only visible to their
+// author until they are published.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+)
+
 type Post struct {
-	Id       int
-	UserID   int
-	Category []string
-	Title    string
-	Content  string
-	About    string
-	Comments int
-	Like     int
-	DisLike  int
+	Id          int
+	UserID      int
+	Author      string
+	Category    []string
+	Tags        []string
+	Images      []Image
+	Attachments []Attachment
+	Reactions   []ReactionCount
+	Edited      *PostRevision
+	Deleted     *Deletion
+	Title       string
+	Content     string
+	ContentHTML template.HTML
+	About       string
+	Comments    int
+	// Question is set for posts filed under a Q&A category. AcceptedID is
+	// the comment their author accepted as the answer, 0 if none.
+	Question   bool
+	AcceptedID int
+	Like       int
+	DisLike    int
+	Status     string
+	PublishAt  time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// AuthorReputation is the reputation of the author, filled in on post
+	// pages and in listings.
+	AuthorReputation int
 }
 
 func NewPost(id, like, dislike, userID, comments int, title, content, about string, category []string) *Post {
-	return &Post{id, userID, category, title, content, about, comments, like, dislike}
+	return &Post{
+		Id:       id,
+		UserID:   userID,
+		Category: category,
+		Title:    title,
+		Content:  content,
+		About:    about,
+		Comments: comments,
+		Like:     like,
+		DisLike:  dislike,
+	}
 }
@@ -0,0 +1,11 @@
+package models
+
+// Profile is the public page of a user.
+type Profile struct {
+	User       User
+	Reputation int
+	Privileges []Privilege
+	Badges     []UserBadge
+	Posts      []Post
+	Comments   []*Comment
+}
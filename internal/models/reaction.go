@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Reaction kinds besides the emoji. A user either likes or dislikes a post
+// or comment, and can add any number of different emoji to it.
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// Reaction targets.
+const (
+	TargetPost    = "post"
+	TargetComment = "comment"
+)
+
+// Reaction is one reaction of a user to a post or comment.
+type Reaction struct {
+	Target    string
+	TargetID  int
+	Kind      string
+	UserID    int
+	Username  string
+	CreatedAt time.Time
+}
+
+// ReactionCount sums up the reactions of one emoji to a post or comment.
+type ReactionCount struct {
+	Emoji string
+	Users []string
+}
+
+// Count is the number of users who reacted with the emoji.
+func (r ReactionCount) Count() int {
+	return len(r.Users)
+}
+
+// Reacted reports whether the user with the given name is among those who
+// reacted with the emoji.
+func (r ReactionCount) Reacted(username string) bool {
+	if username == "" {
+		return false
+	}
+	for _, user := range r.Users {
+		if user == username {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactionTab is one kind of reaction to a post or comment with the number
+// of users who reacted so; Own is set when the viewer is one of them.
+type ReactionTab struct {
+	Kind  string
+	Count int
+	Own   bool
+}
+
+// ReactionPage is one page of the users who reacted to a post or comment
+// in one way, newest first. Pages count from 1.
+type ReactionPage struct {
+	Target    string
+	TargetID  int
+	Kind      string
+	Tabs      []ReactionTab
+	Reactions []Reaction
+	Page      int
+	Pages     int
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Privileges unlocked by reputation.
+const (
+	PrivilegeCreateTags = "create-tags"
+	PrivilegeEditPosts  = "edit-posts"
+)
+
+// ReputationEvent is the reputation the author of a post or comment got
+// for a like or dislike of another user. UserID is the author, ActorID the
+// user who voted.
+type ReputationEvent struct {
+	UserID    int
+	ActorID   int
+	Target    string
+	TargetID  int
+	Kind      string
+	Points    int
+	CreatedAt time.Time
+}
+
+// Privilege is something users may do once their reputation reaches the
+// threshold.
+type Privilege struct {
+	Name      string
+	Threshold int
+	Unlocked  bool
+}
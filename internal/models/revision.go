@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// PostRevision is one saved state of a post. The first revision holds the
+// post as it was created; every edit adds another one.
+type PostRevision struct {
+	ID        int
+	PostID    int
+	Number    int
+	EditorID  int
+	Editor    string
+	CreatedAt time.Time
+	Title     string
+	Content   string
+	Reason    string
+}
+
+// CommentRevision is one saved state of a comment. Revisions are kept
+// from the first edit on; the first of them holds the comment as it was
+// written. Diff compares the text with the revision before.
+type CommentRevision struct {
+	ID        int
+	CommentID int
+	Number    int
+	EditorID  int
+	Editor    string
+	CreatedAt time.Time
+	Text      string
+	Reason    string
+	Diff      []DiffLine
+}
+
+// DiffLine is one line of a line-level diff. Kind is "equal", "insert" or
+// "delete"; the line numbers are 0 where the line is missing on that side.
+type DiffLine struct {
+	Kind    string
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// RevisionDiff compares two revisions of a post.
+type RevisionDiff struct {
+	From    PostRevision
+	To      PostRevision
+	Title   []DiffLine
+	Content []DiffLine
+}
@@ -0,0 +1,10 @@
+package models
+
+type Tag struct {
+	ID        int
+	Name      string
+	SynonymOf int
+	Count     int
+	Weight    int
+	Synonyms  []string
+}
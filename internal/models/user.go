@@ -9,5 +9,24 @@ type User struct {
 	Password  string
 	Token     string
 	ExpiresAt time.Time
+	Timezone  string
+	CreatedAt time.Time
+	// NotifyMentions is set when the user wants to be notified of
+	// mentions.
+	NotifyMentions bool
+	// UnreadNotifications is only filled in for the signed-in user.
+	UnreadNotifications int
 }
 
+// Location returns the timezone the user chose for displaying times, or
+// UTC when there is none.
+func (u User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type Attachment interface {
+	GetAttachmentByID(id int) (models.Attachment, error)
+	GetAttachmentsByPostID(postID int) ([]models.Attachment, error)
+	IncrementDownloads(id int) error
+	DeleteAttachmentsByPostID(postID int, remove func(key string) error) error
+	DeleteAttachmentsByCommentID(commentID int, remove func(key string) error) error
+	GetUsedStorage(userID int) (int64, error)
+	GetUserQuota(userID int) (int64, error)
+	GetUserQuotas() ([]models.UserQuota, error)
+	SetUserQuota(userID int, quota int64) error
+	DeleteUserQuota(userID int) error
+	GetAllowedTypes() ([]string, error)
+	AddAllowedType(mimeType string) error
+	DeleteAllowedType(mimeType string) error
+}
+
+type AttachmentStorage struct {
+	db *sql.DB
+}
+
+func NewAttachmentSqlite(db *sql.DB) *AttachmentStorage {
+	return &AttachmentStorage{db: db}
+}
+
+const attachmentColumns = `id, userid, postid, COALESCE(commentid, 0), name, blobkey, contenttype, size, downloads`
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (models.Attachment, error) {
+	var a models.Attachment
+	err := row.Scan(&a.ID, &a.UserID, &a.PostID, &a.CommentID, &a.Name, &a.Key, &a.ContentType, &a.Size, &a.Downloads)
+	return a, err
+}
+
+// createAttachments writes the attachments of one user inside the
+// transaction that creates their post or comment. It returns
+// ErrQuotaExceeded when the files of the user would then take up more
+// than quota bytes.
+func createAttachments(tx *sql.Tx, postID, commentID int, attachments []*models.Attachment, quota int64) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO attachment (userid, postid, commentid, name, blobkey, contenttype, size) VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	for _, a := range attachments {
+		a.PostID, a.CommentID = postID, commentID
+		result, err := tx.Exec(query, a.UserID, a.PostID, nullInt(a.CommentID), a.Name, a.Key, a.ContentType, a.Size)
+		if err != nil {
+			return fmt.Errorf("storage: create attachments: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("storage: create attachments: %w", err)
+		}
+		a.ID = int(id)
+	}
+
+	var used int64
+	if err := tx.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM attachment WHERE userid = $1;`, attachments[0].UserID).Scan(&used); err != nil {
+		return fmt.Errorf("storage: create attachments: %w", err)
+	}
+	if used > quota {
+		return fmt.Errorf("storage: create attachments: %w", ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// GetAttachmentByID returns the attachment unless it belongs to a comment
+// in the trash.
+func (s *AttachmentStorage) GetAttachmentByID(id int) (models.Attachment, error) {
+	row := s.db.QueryRow(`SELECT `+attachmentColumns+` FROM attachment
+		WHERE id = $1 AND (commentid IS NULL OR commentid IN (SELECT id FROM comment WHERE deleted_at IS NULL));`, id)
+	a, err := scanAttachment(row)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("storage: get attachment by id: %w", err)
+	}
+	return a, nil
+}
+
+// GetAttachmentsByPostID returns the files of the post and of its comments.
+func (s *AttachmentStorage) GetAttachmentsByPostID(postID int) ([]models.Attachment, error) {
+	rows, err := s.db.Query(`SELECT `+attachmentColumns+` FROM attachment WHERE postid = $1 ORDER BY id;`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get attachments by post id: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("storage: get attachments by post id: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+func (s *AttachmentStorage) IncrementDownloads(id int) error {
+	if _, err := s.db.Exec(`UPDATE attachment SET downloads = downloads + 1 WHERE id = $1;`, id); err != nil {
+		return fmt.Errorf("storage: increment downloads: %w", err)
+	}
+	return nil
+}
+
+// DeleteAttachmentsByPostID removes the files of the post and of its
+// comments and calls remove, in the same transaction, for every blob no
+// other attachment or image shares.
+func (s *AttachmentStorage) DeleteAttachmentsByPostID(postID int, remove func(key string) error) error {
+	if err := s.deleteAttachments(remove, `postid = $1`, postID); err != nil {
+		return fmt.Errorf("storage: delete attachments by post id: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentStorage) DeleteAttachmentsByCommentID(commentID int, remove func(key string) error) error {
+	if err := s.deleteAttachments(remove, `commentid = $1`, commentID); err != nil {
+		return fmt.Errorf("storage: delete attachments by comment id: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentStorage) deleteAttachments(remove func(key string) error, condition string, args ...interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteUnreferenced(tx, remove, `DELETE FROM attachment WHERE `+condition+` RETURNING blobkey;`, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *AttachmentStorage) GetUsedStorage(userID int) (int64, error) {
+	var used int64
+	if err := s.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM attachment WHERE userid = $1;`, userID).Scan(&used); err != nil {
+		return 0, fmt.Errorf("storage: get used storage: %w", err)
+	}
+	return used, nil
+}
+
+// GetUserQuota returns sql.ErrNoRows when the user has the default quota.
+func (s *AttachmentStorage) GetUserQuota(userID int) (int64, error) {
+	var quota int64
+	if err := s.db.QueryRow(`SELECT quota FROM user_quota WHERE userid = $1;`, userID).Scan(&quota); err != nil {
+		return 0, fmt.Errorf("storage: get user quota: %w", err)
+	}
+	return quota, nil
+}
+
+func (s *AttachmentStorage) GetUserQuotas() ([]models.UserQuota, error) {
+	query := `SELECT user_quota.userid, user.username, user_quota.quota FROM user_quota
+		INNER JOIN user ON user.id = user_quota.userid ORDER BY user.username;`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get user quotas: %w", err)
+	}
+	defer rows.Close()
+
+	var quotas []models.UserQuota
+	for rows.Next() {
+		var q models.UserQuota
+		if err := rows.Scan(&q.UserID, &q.Username, &q.Limit); err != nil {
+			return nil, fmt.Errorf("storage: get user quotas: %w", err)
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+func (s *AttachmentStorage) SetUserQuota(userID int, quota int64) error {
+	query := `INSERT INTO user_quota (userid, quota) VALUES ($1, $2) ON CONFLICT (userid) DO UPDATE SET quota = excluded.quota;`
+	if _, err := s.db.Exec(query, userID, quota); err != nil {
+		return fmt.Errorf("storage: set user quota: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentStorage) DeleteUserQuota(userID int) error {
+	if _, err := s.db.Exec(`DELETE FROM user_quota WHERE userid = $1;`, userID); err != nil {
+		return fmt.Errorf("storage: delete user quota: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentStorage) GetAllowedTypes() ([]string, error) {
+	rows, err := s.db.Query(`SELECT mimetype FROM allowed_type ORDER BY mimetype;`)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get allowed types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("storage: get allowed types: %w", err)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+func (s *AttachmentStorage) AddAllowedType(mimeType string) error {
+	if _, err := s.db.Exec(`INSERT OR IGNORE INTO allowed_type (mimetype) VALUES ($1);`, mimeType); err != nil {
+		return fmt.Errorf("storage: add allowed type: %w", err)
+	}
+	return nil
+}
+
+func (s *AttachmentStorage) DeleteAllowedType(mimeType string) error {
+	if _, err := s.db.Exec(`DELETE FROM allowed_type WHERE mimetype = $1;`, mimeType); err != nil {
+		return fmt.Errorf("storage: delete allowed type: %w", err)
+	}
+	return nil
+}
@@ -14,6 +14,8 @@ type Authorization interface {
 	AddSessionToken(email, token string, expiresAt time.Time) error
 	GetSessionToken(token string) (models.User, error)
 	DeleteSessionToken(token string) error
+	SetTimezone(userID int, timezone string) error
+	SetNotifyMentions(userID int, notify bool) error
 }
 
 type AuthStorage struct {
@@ -25,8 +27,8 @@ func NewAuthSqlite(db *sql.DB) *AuthStorage {
 }
 
 func (r *AuthStorage) CreateUser(user *models.User) error {
-	query := fmt.Sprintf("INSERT INTO user (username, email, password) values ($1, $2, $3)")
-	_, err := r.db.Exec(query, user.Username, user.Email, user.Password)
+	query := fmt.Sprintf("INSERT INTO user (username, email, password, created_at) values ($1, $2, $3, $4)")
+	_, err := r.db.Exec(query, user.Username, user.Email, user.Password, nullTime(user.CreatedAt))
 	if err != nil {
 		return err
 	}
@@ -46,13 +48,17 @@ func (s *AuthStorage) GetUserByEmail(email string) (models.User, error) {
 }
 
 func (s *AuthStorage) GetUserByUsername(username string) (models.User, error) {
-	query := `SELECT id, email, username, password FROM user WHERE username=$1;`
+	query := `SELECT id, email, username, password, created_at, COALESCE(notify_mentions, 1) FROM user WHERE username=$1;`
 	row := s.db.QueryRow(query, username)
-	var user models.User
-	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+	var (
+		user      models.User
+		createdAt sql.NullTime
+	)
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &createdAt, &user.NotifyMentions)
 	if err != nil {
 		return models.User{}, fmt.Errorf("storage: get user by login: %w", err)
 	}
+	user.CreatedAt = createdAt.Time
 	return user, nil
 }
 
@@ -66,11 +72,14 @@ func (s *AuthStorage) AddSessionToken(email, token string, expiresAt time.Time)
 }
 
 func (s *AuthStorage) GetSessionToken(token string) (models.User, error) {
-	query := `SELECT id, email, username, password, token, expiresAt FROM user WHERE token=$1;`
+	query := `SELECT id, email, username, password, token, expiresAt, COALESCE(timezone, ''), COALESCE(notify_mentions, 1),
+		(SELECT COUNT(*) FROM notification n WHERE n.userid = user.id AND n.read_at IS NULL AND ` + visibleNotification + `)
+		FROM user WHERE token=$1;`
 
 	row := s.db.QueryRow(query, token)
 	var user models.User
-	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Token, &user.ExpiresAt)
+	err := row.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Token, &user.ExpiresAt, &user.Timezone,
+		&user.NotifyMentions, &user.UnreadNotifications)
 	if err != nil {
 		return models.User{}, fmt.Errorf("storage: get user by login: %w", err)
 	}
@@ -85,3 +94,19 @@ func (s *AuthStorage) DeleteSessionToken(token string) error {
 	}
 	return nil
 }
+
+func (s *AuthStorage) SetTimezone(userID int, timezone string) error {
+	query := `UPDATE user SET timezone = $1 WHERE id = $2;`
+	if _, err := s.db.Exec(query, timezone, userID); err != nil {
+		return fmt.Errorf("storage: set timezone: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthStorage) SetNotifyMentions(userID int, notify bool) error {
+	query := `UPDATE user SET notify_mentions = $1 WHERE id = $2;`
+	if _, err := s.db.Exec(query, notify, userID); err != nil {
+		return fmt.Errorf("storage: set notify mentions: %w", err)
+	}
+	return nil
+}
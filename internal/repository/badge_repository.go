@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+type Badge interface {
+	AwardBadge(userID int, slug string, at time.Time) error
+	GetUserBadges(userID int) ([]models.UserBadge, error)
+	GetBadgeHolders(slug string) ([]models.UserBadge, error)
+	CountBadgeHolders() (map[string]int, error)
+	GetUserStats(userID int) (models.UserStats, error)
+	GetAllUserStats() (map[int]models.UserStats, error)
+}
+
+type BadgeStorage struct {
+	db *sql.DB
+}
+
+func NewBadgeSqlite(db *sql.DB) *BadgeStorage {
+	return &BadgeStorage{db: db}
+}
+
+// AwardBadge gives the badge to the user unless the user holds it already.
+func (s *BadgeStorage) AwardBadge(userID int, slug string, at time.Time) error {
+	if _, err := s.db.Exec(`INSERT OR IGNORE INTO user_badge (userid, badge, awarded_at) VALUES ($1, $2, $3);`, userID, slug, at.UTC()); err != nil {
+		return fmt.Errorf("storage: award badge: %w", err)
+	}
+	return nil
+}
+
+// GetUserBadges returns the badges of the user with only the slug of the
+// badge set, in the order they were awarded.
+func (s *BadgeStorage) GetUserBadges(userID int) ([]models.UserBadge, error) {
+	badges, err := s.queryBadges(`SELECT b.userid, u.username, b.badge, b.awarded_at FROM user_badge b JOIN user u ON u.id = b.userid
+		WHERE b.userid = $1 ORDER BY b.awarded_at, b.badge;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get user badges: %w", err)
+	}
+	return badges, nil
+}
+
+// GetBadgeHolders returns the users holding the badge, the latest first.
+func (s *BadgeStorage) GetBadgeHolders(slug string) ([]models.UserBadge, error) {
+	badges, err := s.queryBadges(`SELECT b.userid, u.username, b.badge, b.awarded_at FROM user_badge b JOIN user u ON u.id = b.userid
+		WHERE b.badge = $1 ORDER BY b.awarded_at DESC, u.username;`, slug)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get badge holders: %w", err)
+	}
+	return badges, nil
+}
+
+func (s *BadgeStorage) queryBadges(query string, args ...interface{}) ([]models.UserBadge, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var badges []models.UserBadge
+	for rows.Next() {
+		var (
+			badge     models.UserBadge
+			awardedAt sql.NullTime
+		)
+		if err := rows.Scan(&badge.UserID, &badge.Username, &badge.Slug, &awardedAt); err != nil {
+			return nil, err
+		}
+		badge.AwardedAt = awardedAt.Time
+		badges = append(badges, badge)
+	}
+	return badges, rows.Err()
+}
+
+// CountBadgeHolders counts the holders of each badge by slug.
+func (s *BadgeStorage) CountBadgeHolders() (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT badge, COUNT(*) FROM user_badge GROUP BY badge;`)
+	if err != nil {
+		return nil, fmt.Errorf("storage: count badge holders: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			slug  string
+			count int
+		)
+		if err := rows.Scan(&slug, &count); err != nil {
+			return nil, fmt.Errorf("storage: count badge holders: %w", err)
+		}
+		counts[slug] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetUserStats counts the published posts of the user, the comments of
+// the user accepted as answers to posts of others and the likes others
+// gave to the posts and comments of the user. Posts and comments in the
+// trash do not count.
+func (s *BadgeStorage) GetUserStats(userID int) (models.UserStats, error) {
+	query := `SELECT
+		(SELECT COUNT(*) FROM post WHERE userid = $1 AND deleted_at IS NULL AND status = 'published'),
+		(SELECT COUNT(*) FROM post p JOIN comment c ON c.id = p.accepted_commentid
+			WHERE c.userid = $1 AND c.userid != p.userid AND c.deleted_at IS NULL AND p.deleted_at IS NULL),
+		(SELECT COUNT(*) FROM reaction r WHERE r.kind = 'like' AND r.userid != $1 AND (
+			r.target = 'post' AND r.targetid IN (SELECT id FROM post WHERE userid = $1 AND deleted_at IS NULL) OR
+			r.target = 'comment' AND r.targetid IN (SELECT id FROM comment WHERE userid = $1 AND deleted_at IS NULL))),
+		created_at
+		FROM user WHERE id = $1;`
+	var (
+		stats    models.UserStats
+		joinedAt sql.NullTime
+	)
+	if err := s.db.QueryRow(query, userID).Scan(&stats.Posts, &stats.AcceptedAnswers, &stats.LikesReceived, &joinedAt); err != nil {
+		return models.UserStats{}, fmt.Errorf("storage: get user stats: %w", err)
+	}
+	stats.JoinedAt = joinedAt.Time
+	return stats, nil
+}
+
+// GetAllUserStats returns the stats of every user by user id, counted
+// the way GetUserStats counts them.
+func (s *BadgeStorage) GetAllUserStats() (map[int]models.UserStats, error) {
+	query := `SELECT u.id, COALESCE(p.posts, 0), COALESCE(a.answers, 0), COALESCE(l.likes, 0), u.created_at
+		FROM user u
+		LEFT JOIN (SELECT userid, COUNT(*) AS posts FROM post WHERE deleted_at IS NULL AND status = 'published' GROUP BY userid) p ON p.userid = u.id
+		LEFT JOIN (SELECT c.userid, COUNT(*) AS answers FROM post p JOIN comment c ON c.id = p.accepted_commentid
+			WHERE c.userid != p.userid AND c.deleted_at IS NULL AND p.deleted_at IS NULL GROUP BY c.userid) a ON a.userid = u.id
+		LEFT JOIN (SELECT author, COUNT(*) AS likes FROM (
+				SELECT p.userid AS author FROM reaction r JOIN post p ON p.id = r.targetid
+				WHERE r.target = 'post' AND r.kind = 'like' AND r.userid != p.userid AND p.deleted_at IS NULL
+				UNION ALL
+				SELECT c.userid FROM reaction r JOIN comment c ON c.id = r.targetid
+				WHERE r.target = 'comment' AND r.kind = 'like' AND r.userid != c.userid AND c.deleted_at IS NULL
+			) GROUP BY author) l ON l.author = u.id;`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get all user stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[int]models.UserStats)
+	for rows.Next() {
+		var (
+			userID   int
+			user     models.UserStats
+			joinedAt sql.NullTime
+		)
+		if err := rows.Scan(&userID, &user.Posts, &user.AcceptedAnswers, &user.LikesReceived, &joinedAt); err != nil {
+			return nil, fmt.Errorf("storage: get all user stats: %w", err)
+		}
+		user.JoinedAt = joinedAt.Time
+		stats[userID] = user
+	}
+	return stats, rows.Err()
+}
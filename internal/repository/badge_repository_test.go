@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "database.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := CreateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAcceptedAnswersLeaveOutSelfAccepted(t *testing.T) {
+	db := newTestDB(t)
+	queries := []string{
+		`INSERT INTO user (id, email, username) VALUES (1, 'alice@x.io', 'alice'), (2, 'bob@x.io', 'bob');`,
+		`INSERT INTO post (id, userid, title, content) VALUES (1, 1, 'own', 'answered by alice'), (2, 1, 'other', 'answered by bob');`,
+		`INSERT INTO comment (id, userid, postid, text) VALUES (1, 1, 1, 'alice'), (2, 2, 2, 'bob');`,
+		`UPDATE post SET accepted_commentid = id;`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewBadgeSqlite(db)
+	all, err := s.GetAllUserStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for userID, want := range map[int]int{1: 0, 2: 1} {
+		stats, err := s.GetUserStats(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.AcceptedAnswers != want {
+			t.Errorf("GetUserStats(%d).AcceptedAnswers = %d, want %d", userID, stats.AcceptedAnswers, want)
+		}
+		if got := all[userID].AcceptedAnswers; got != want {
+			t.Errorf("GetAllUserStats()[%d].AcceptedAnswers = %d, want %d", userID, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/config"
+	"forum/internal/models"
+	"mime"
+	"strings"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files. Keys are slash separated paths such as
+// "<hash>.jpg" or "w320/<hash>.jpg".
+type BlobStore interface {
+	Put(key, contentType string, data []byte) error
+	Get(key string) ([]byte, error)
+	Exists(key string) (bool, error)
+	Delete(key string) error
+	List() ([]string, error)
+	// URL returns a signed download URL valid for at least expiry. A
+	// non-empty download name makes browsers save the file under that name
+	// instead of displaying it.
+	URL(key string, expiry time.Duration, download string) (string, error)
+	// Verify checks a signature made by URL. Stores whose URLs point to
+	// another server always report false.
+	Verify(key string, expires int64, download, signature string) bool
+}
+
+// NewBlobStore creates the store selected in the configuration.
+func NewBlobStore(cfg config.Blob) (BlobStore, error) {
+	switch cfg.Backend {
+	case "local":
+		secret := []byte(cfg.Secret)
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, fmt.Errorf("storage: blob secret: %w", err)
+			}
+		}
+		return NewLocalBlobStore(cfg.Dir, secret), nil
+	case "s3":
+		return NewS3BlobStore(cfg.S3)
+	default:
+		return nil, fmt.Errorf("storage: unknown blob backend %q", cfg.Backend)
+	}
+}
+
+// urlWindow returns the start and lifetime of a signed URL. Rounding the
+// start down keeps URLs identical within a window, so browsers can cache
+// them, while every URL stays valid for at least expiry.
+func urlWindow(expiry time.Duration) (time.Time, time.Duration) {
+	return time.Now().UTC().Truncate(expiry), 2 * expiry
+}
+
+// ContentDisposition returns the header value asking browsers to save a
+// download under name.
+func ContentDisposition(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
+
+func validBlobKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// Files are the images and attachments written with a new post or
+// comment. Put stores their blobs. It runs inside the transaction that
+// writes the rows, after them, so a concurrent delete of the last other
+// row sharing one of the blobs either sees the new rows and keeps the
+// blob, or has removed it before Put stores it again. Quota caps the
+// attachments of the author in bytes.
+type Files struct {
+	Images      []*models.Image
+	Attachments []*models.Attachment
+	Quota       int64
+	Put         func() error
+}
+
+// createFiles writes the rows of files for the post or comment inside the
+// transaction that creates it and then puts their blobs.
+func createFiles(tx *sql.Tx, postID, commentID int, files Files) error {
+	if err := createImages(tx, postID, files.Images); err != nil {
+		return err
+	}
+	if err := createAttachments(tx, postID, commentID, files.Attachments, files.Quota); err != nil {
+		return err
+	}
+	if files.Put == nil {
+		return nil
+	}
+	return files.Put()
+}
+
+// deleteUnreferenced runs a DELETE on image or attachment that returns the
+// blob keys of the removed rows, and calls remove for every key no row
+// points to any more. The DELETE takes the write lock, which createFiles
+// needs as well, so no new row can start pointing to a blob between the
+// check and its removal.
+func deleteUnreferenced(tx *sql.Tx, remove func(key string) error, query string, args ...interface{}) error {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		var count int
+		query := `SELECT (SELECT COUNT(*) FROM image WHERE filename = $1) + (SELECT COUNT(*) FROM attachment WHERE blobkey = $1);`
+		if err := tx.QueryRow(query, key).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
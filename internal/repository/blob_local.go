@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LocalBlobStore keeps blobs as files below a directory. Its download URLs
+// point at /blobs/ on the forum itself and are signed with an HMAC.
+type LocalBlobStore struct {
+	dir    string
+	secret []byte
+}
+
+func NewLocalBlobStore(dir string, secret []byte) *LocalBlobStore {
+	return &LocalBlobStore{dir: dir, secret: secret}
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("storage: invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial blob.
+func (s *LocalBlobStore) Put(key, contentType string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: get blob: %w", err)
+	}
+	return data, nil
+}
+
+func (s *LocalBlobStore) Exists(key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("storage: blob exists: %w", err)
+	}
+	return true, nil
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("storage: delete blob: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalBlobStore) List() ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); validBlobKey(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: list blobs: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *LocalBlobStore) URL(key string, expiry time.Duration, download string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("storage: invalid blob key %q", key)
+	}
+
+	start, lifetime := urlWindow(expiry)
+	expires := start.Add(lifetime).Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if download != "" {
+		query.Set("download", download)
+	}
+	query.Set("signature", s.sign(key, expires, download))
+	return "/blobs/" + key + "?" + query.Encode(), nil
+}
+
+func (s *LocalBlobStore) Verify(key string, expires int64, download, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires, download)))
+}
+
+func (s *LocalBlobStore) sign(key string, expires int64, download string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d\n%s", key, expires, download)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,370 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"forum/internal/config"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3DateFormat    = "20060102T150405Z"
+	s3MaxURLExpiry  = 7 * 24 * time.Hour
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3BlobStore keeps blobs in a bucket of an S3-compatible object store.
+// Requests are signed with AWS Signature Version 4 and download URLs are
+// presigned, so browsers fetch files from the store directly.
+type S3BlobStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	client    *http.Client
+}
+
+func NewS3BlobStore(cfg config.S3) (*S3BlobStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage: s3 blob store needs an endpoint and a bucket")
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	return &S3BlobStore{
+		endpoint:  endpoint,
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		pathStyle: cfg.PathStyle,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3BlobStore) Put(key, contentType string, data []byte) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("storage: put blob: %w", s3Error(resp))
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrBlobNotFound
+	default:
+		return nil, fmt.Errorf("storage: get blob: %w", s3Error(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get blob: %w", err)
+	}
+	return data, nil
+}
+
+func (s *S3BlobStore) Exists(key string) (bool, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("storage: blob exists: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("storage: blob exists: %w", s3Error(resp))
+	}
+}
+
+// Delete succeeds for missing keys too, like DELETE in S3 itself.
+func (s *S3BlobStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("storage: delete blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("storage: delete blob: %w", s3Error(resp))
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3BlobStore) List() ([]string, error) {
+	var (
+		keys  []string
+		token string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("storage: list blobs: %w", err)
+		}
+
+		var result s3ListResult
+		if resp.StatusCode != http.StatusOK {
+			err = s3Error(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("storage: list blobs: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// URL presigns a GET request for the key. The download name is passed as
+// response-content-disposition, which the store echoes as a header.
+func (s *S3BlobStore) URL(key string, expiry time.Duration, download string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("storage: invalid blob key %q", key)
+	}
+
+	// Stores refuse URLs that live longer than s3MaxURLExpiry. The window
+	// lasts twice the expiry, so the expiry is clamped before rounding, or
+	// URLs would come out nearly or already expired.
+	if expiry > s3MaxURLExpiry/2 {
+		expiry = s3MaxURLExpiry / 2
+	}
+	start, lifetime := urlWindow(expiry)
+
+	u := s.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(start))
+	query.Set("X-Amz-Date", start.Format(s3DateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(lifetime.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if download != "" {
+		query.Set("response-content-disposition", ContentDisposition(download))
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	header := http.Header{}
+	header.Set("Host", u.Host)
+	signature := s.signature(start, http.MethodGet, u, header, unsignedPayload)
+
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// Verify always fails: presigned URLs are checked by the object store.
+func (s *S3BlobStore) Verify(key string, expires int64, download, signature string) bool {
+	return false
+}
+
+func (s *S3BlobStore) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	if key != "" && !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256Hex(body)
+	req.Header.Set("Host", u.Host)
+	req.Header.Set("X-Amz-Date", now.Format(s3DateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := http.Header{}
+	for _, name := range []string{"Host", "Content-Type", "X-Amz-Date", "X-Amz-Content-Sha256"} {
+		if value := req.Header.Get(name); value != "" {
+			signed.Set(name, value)
+		}
+	}
+	signature := s.signature(now, method, u, signed, payloadHash)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, s.scope(now), signedHeaders(signed), signature))
+	req.Header.Del("Host")
+
+	return s.client.Do(req)
+}
+
+// objectURL returns the URL of key, or of the bucket when key is empty.
+func (s *S3BlobStore) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		path += "/" + s.bucket
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = path + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+func (s *S3BlobStore) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature implements the AWS Signature Version 4 signing steps.
+func (s *S3BlobStore) signature(t time.Time, method string, u *url.URL, header http.Header, payloadHash string) string {
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		u.RawQuery,
+		canonicalHeaders(header),
+		signedHeaders(header),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3DateFormat),
+		s.scope(t),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalHeaders(header http.Header) string {
+	var b strings.Builder
+	for _, name := range sortedHeaderNames(header) {
+		b.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+	return b.String()
+}
+
+func signedHeaders(header http.Header) string {
+	return strings.Join(sortedHeaderNames(header), ";")
+}
+
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canonicalQuery encodes the query sorted by key as SigV4 requires.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything except unreserved characters. The
+// slash is kept unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+)
+
+type Category interface {
+	GetCategories(hidden []string) ([]models.Category, error)
+	GetCategoryByID(id int) (models.Category, error)
+	GetModerators(categoryID int) ([]models.User, error)
+	GetModeratedCategoryIDs(userID int) ([]int, error)
+	SetCategoryQA(categoryID int, qa bool) error
+}
+
+type CategoryStorage struct {
+	db *sql.DB
+}
+
+func NewCategorySqlite(db *sql.DB) *CategoryStorage {
+	return &CategoryStorage{db: db}
+}
+
+const categoryColumns = `c.id, COALESCE(c.parentid, 0), c.name, c.description, c.position, c.qa`
+
+// GetCategories returns every category with its post count and latest post.
+// Posts filed under any of the hidden categories are left out of both.
+func (s *CategoryStorage) GetCategories(hidden []string) ([]models.Category, error) {
+	filter, filterArgs := excludeCategories("p.id", hidden)
+	query := `SELECT ` + categoryColumns + `,
+		(SELECT COUNT(*) FROM post_category pc JOIN post p ON p.id = pc.postID WHERE pc.category = c.name AND p.deleted_at IS NULL AND p.status = 'published'` + filter + `),
+		COALESCE(lp.id, 0), COALESCE(lp.title, ''), lp.created_at
+	FROM category c
+	LEFT JOIN post lp ON lp.id = (
+		SELECT p.id FROM post_category pc JOIN post p ON p.id = pc.postID WHERE pc.category = c.name AND p.deleted_at IS NULL AND p.status = 'published'` + filter + `
+		ORDER BY p.created_at DESC, p.id DESC LIMIT 1
+	)
+	ORDER BY c.position, c.id;`
+
+	args := append(append([]interface{}{}, filterArgs...), filterArgs...)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var (
+			c          models.Category
+			lastPostAt sql.NullTime
+		)
+		if err := rows.Scan(&c.ID, &c.ParentID, &c.Name, &c.Description, &c.Position, &c.QA, &c.PostCount, &c.LastPostID, &c.LastPostTitle, &lastPostAt); err != nil {
+			return nil, fmt.Errorf("storage: get categories: %w", err)
+		}
+		c.LastPostAt = lastPostAt.Time
+		categories = append(categories, c)
+	}
+	return categories, nil
+}
+
+func (s *CategoryStorage) GetCategoryByID(id int) (models.Category, error) {
+	query := `SELECT ` + categoryColumns + ` FROM category c WHERE c.id = ?;`
+	var c models.Category
+	err := s.db.QueryRow(query, id).Scan(&c.ID, &c.ParentID, &c.Name, &c.Description, &c.Position, &c.QA)
+	if err != nil {
+		return models.Category{}, fmt.Errorf("storage: get category by id: %w", err)
+	}
+	return c, nil
+}
+
+func (s *CategoryStorage) GetModerators(categoryID int) ([]models.User, error) {
+	query := `SELECT u.id, u.username FROM category_moderator m JOIN user u ON u.id = m.userid WHERE m.categoryid = $1 ORDER BY u.username;`
+	rows, err := s.db.Query(query, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get moderators: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, fmt.Errorf("storage: get moderators: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// GetModeratedCategoryIDs returns the ids of the categories the user was
+// made a moderator of, not counting their subcategories.
+func (s *CategoryStorage) GetModeratedCategoryIDs(userID int) ([]int, error) {
+	ids, err := queryIDs(s.db, `SELECT categoryid FROM category_moderator WHERE userid = $1;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get moderated category ids: %w", err)
+	}
+	return ids, nil
+}
+
+// SetCategoryQA turns the Q&A mode of the category on or off.
+func (s *CategoryStorage) SetCategoryQA(categoryID int, qa bool) error {
+	result, err := s.db.Exec(`UPDATE category SET qa = $1 WHERE id = $2;`, qa, categoryID)
+	if err != nil {
+		return fmt.Errorf("storage: set category qa: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("storage: set category qa: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// excludeCategories builds an "AND column NOT IN (...)" clause dropping posts
+// filed under any of the given categories. It uses positional "?" arguments.
+func excludeCategories(column string, categories []string) (string, []interface{}) {
+	if len(categories) == 0 {
+		return "", nil
+	}
+
+	args := make([]interface{}, len(categories))
+	marks := make([]string, len(categories))
+	for i, category := range categories {
+		args[i] = category
+		marks[i] = "?"
+	}
+	clause := " AND " + column + " NOT IN (SELECT postID FROM post_category WHERE category IN (" + strings.Join(marks, ", ") + "))"
+	return clause, args
+}
@@ -4,18 +4,24 @@ import (
 	"database/sql"
 	"fmt"
 	"forum/internal/models"
+	"html/template"
+	"strings"
+	"time"
 )
 
 type Comment interface {
-	CreateComment(comment *models.Comment) error
-	GetComments(postID int) ([]*models.Comment, error)
+	CreateComment(comment *models.Comment, files Files) error
+	GetRootCommentIDs(postID int, sort string) ([]int, error)
+	GetCommentTrees(rootIDs []int) ([]*models.Comment, error)
+	GetCommentsByUser(userID int) ([]*models.Comment, error)
 	GetCommentByID(commentID int) (models.Comment, error)
-	CommentHasLike(commentID int, username string) error
-	CommentHasDislike(commentID int, username string) error
-	RemoveLikeComment(commentID int, username string) error
-	RemoveDislikeComment(commentID int, username string) error
-	LikeComment(commentID int, username string) error
-	DislikeComment(commentID int, username string) error
+	SetCommentHTML(commentID int, textHTML string) error
+	UpdateComment(revision *models.CommentRevision, textHTML string) error
+	DeleteComment(commentID, userID int, reason string, at time.Time) error
+	RestoreComment(commentID int) error
+	GetDeletedComments() ([]*models.Comment, error)
+	GetCommentsDeletedBefore(t time.Time) ([]int, error)
+	PurgeComment(commentID int) error
 }
 
 type CommentStorage struct {
@@ -26,129 +32,313 @@ func NewCommentSqlite(db *sql.DB) *CommentStorage {
 	return &CommentStorage{db: db}
 }
 
-func (c *CommentStorage) CreateComment(comment *models.Comment) error {
-	query := fmt.Sprintf(`INSERT INTO comment (author, text, postid) values ($1, $2, $3)`)
-	res, err := c.db.Exec(query, comment.Author, comment.Text, comment.PostID)
+// CreateComment stores the comment with its files in one transaction.
+func (c *CommentStorage) CreateComment(comment *models.Comment, files Files) error {
+	tx, err := c.db.Begin()
 	if err != nil {
-		return err
+		return fmt.Errorf("repository: create commentary: %w", err)
 	}
-	_, err = res.LastInsertId()
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`INSERT INTO comment (userid, text, text_html, postid, parentid, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7)`)
+	res, err := tx.Exec(query, comment.UserID, comment.Text, string(comment.TextHTML), comment.PostID, nullInt(comment.ParentID),
+		nullTime(comment.CreatedAt), nullTime(comment.UpdatedAt))
 	if err != nil {
-		return fmt.Errorf("repository: create commentary: Insert query - %w", err)
+		return err
 	}
-	_, err = res.RowsAffected()
+	id, err := res.LastInsertId()
 	if err != nil {
 		return fmt.Errorf("repository: create commentary: Insert query - %w", err)
 	}
 
+	if err := createFiles(tx, comment.PostID, int(id), files); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("repository: create commentary: %w", err)
+	}
+	comment.ID = int(id)
 	return nil
 }
 
-func (c *CommentStorage) GetComments(postID int) ([]*models.Comment, error) {
-	var comments []*models.Comment
-	query := fmt.Sprintf(`SELECT * FROM comment WHERE postid = $1;`)
-	rows, err := c.db.Query(query, postID)
+// commentColumns are the columns GetCommentTrees reads, in order.
+// Comments are selected FROM commentsWithAuthor.
+const commentColumns = `c.id, COALESCE(c.userid, 0), COALESCE(u.username, ''), COALESCE(u.reputation, 0), c.postid, COALESCE(c.parentid, 0), c.text, c.text_html,
+	c.like, c.dislike, c.created_at, c.updated_at, c.deleted_at`
+
+// commentsWithAuthor joins every comment with its author.
+const commentsWithAuthor = `comment c LEFT JOIN user u ON u.id = c.userid`
+
+// commentOrders are the ORDER BY clauses of the comment sort orders. Best
+// ranks by the share of likes among the votes, counting one like and one
+// dislike extra so a single like does not beat ten likes and a dislike.
+var commentOrders = map[string]string{
+	models.CommentsOldest: `c.created_at, c.id`,
+	models.CommentsNewest: `c.created_at DESC, c.id DESC`,
+	models.CommentsBest:   `(c.like + 1.0) / (c.like + c.dislike + 2) DESC, c.like DESC, c.created_at, c.id`,
+}
+
+// GetRootCommentIDs returns the ids of the top-level comments of the post
+// in the given sort order, oldest first for unknown orders. Replies to
+// comments that are gone count as top-level comments. Comments in the
+// trash are left out unless a reply below them is not.
+func (c *CommentStorage) GetRootCommentIDs(postID int, sort string) ([]int, error) {
+	order, ok := commentOrders[sort]
+	if !ok {
+		order = commentOrders[models.CommentsOldest]
+	}
+
+	// live holds the comments with a reply outside the trash somewhere
+	// below them, which stay as placeholders when they are deleted.
+	query := `WITH RECURSIVE live(id) AS (
+			SELECT parentid FROM comment WHERE postid = $1 AND deleted_at IS NULL AND parentid IS NOT NULL
+			UNION SELECT p.parentid FROM comment p JOIN live l ON p.id = l.id WHERE p.parentid IS NOT NULL
+		)
+		SELECT c.id FROM comment c
+		WHERE c.postid = $1
+		AND (c.parentid IS NULL OR c.parentid NOT IN (SELECT id FROM comment WHERE postid = $1))
+		AND (c.deleted_at IS NULL OR c.id IN (SELECT id FROM live))
+		ORDER BY ` + order + `;`
+	ids, err := queryIDs(c.db, query, postID)
 	if err != nil {
-		return nil, fmt.Errorf("repository: get commentaries of the post: query - %w", err)
+		return nil, fmt.Errorf("storage: get root comment ids: %w", err)
 	}
+	return ids, nil
+}
 
+// GetCommentTrees returns the given comments and all replies below them as
+// a flat list, oldest first. Replies point at their comment through
+// ParentID. Comments in the trash are included with Deleted set, so their
+// replies keep their place.
+func (c *CommentStorage) GetCommentTrees(rootIDs []int) ([]*models.Comment, error) {
+	if len(rootIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(rootIDs))
+	params := make([]string, len(rootIDs))
+	for i, id := range rootIDs {
+		args[i] = id
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	query := `WITH RECURSIVE tree(id) AS (
+			SELECT id FROM comment WHERE id IN (` + strings.Join(params, ", ") + `)
+			UNION SELECT r.id FROM comment r JOIN tree t ON r.parentid = t.id
+		)
+		SELECT ` + commentColumns + ` FROM ` + commentsWithAuthor + `
+		WHERE c.id IN (SELECT id FROM tree) ORDER BY c.created_at, c.id;`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get comment trees: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
 	for rows.Next() {
 		c := &models.Comment{}
-		if err = rows.Scan(&c.ID, &c.Author, &c.PostID, &c.Text, &c.Likes, &c.DisLikes); err != nil {
-			return nil, fmt.Errorf("repository: get commentaries of the post: query - %w", err)
+		var (
+			textHTML                        string
+			createdAt, updatedAt, deletedAt sql.NullTime
+		)
+		if err = rows.Scan(&c.ID, &c.UserID, &c.Author, &c.AuthorReputation, &c.PostID, &c.ParentID, &c.Text, &textHTML, &c.Likes, &c.DisLikes, &createdAt, &updatedAt, &deletedAt); err != nil {
+			return nil, fmt.Errorf("storage: get comment trees: %w", err)
+		}
+		c.TextHTML = template.HTML(textHTML)
+		c.CreatedAt, c.UpdatedAt = createdAt.Time, updatedAt.Time
+		if deletedAt.Valid {
+			c.Deleted = &models.Deletion{At: deletedAt.Time}
 		}
 		comments = append(comments, c)
 	}
-	rows.Close()
-	return comments, nil
+	return comments, rows.Err()
+}
+
+// GetCommentsByUser returns the comments the user wrote under published
+// posts, newest first, with the title of their post.
+func (c *CommentStorage) GetCommentsByUser(userID int) ([]*models.Comment, error) {
+	query := `SELECT c.id, COALESCE(c.userid, 0), COALESCE(u.username, ''), c.postid, p.title, c.text, c.text_html, c.like, c.dislike, c.created_at, c.updated_at
+		FROM ` + commentsWithAuthor + ` JOIN post p ON p.id = c.postid
+		WHERE c.userid = $1 AND c.deleted_at IS NULL AND p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY c.created_at DESC, c.id DESC;`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get comments by user: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var (
+			comment              models.Comment
+			textHTML             string
+			createdAt, updatedAt sql.NullTime
+		)
+		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.Author, &comment.PostID, &comment.PostTitle, &comment.Text, &textHTML,
+			&comment.Likes, &comment.DisLikes, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("storage: get comments by user: %w", err)
+		}
+		comment.TextHTML = template.HTML(textHTML)
+		comment.CreatedAt, comment.UpdatedAt = createdAt.Time, updatedAt.Time
+		comments = append(comments, &comment)
+	}
+	return comments, rows.Err()
 }
 
+// GetCommentByID returns deleted comments too, with Deleted set.
 func (c *CommentStorage) GetCommentByID(commentID int) (models.Comment, error) {
-	var comment models.Comment
+	var (
+		comment                         models.Comment
+		deletion                        models.Deletion
+		createdAt, updatedAt, deletedAt sql.NullTime
+	)
 
-	query := `SELECT id, postid, author, text, like, dislike FROM comment WHERE id=$1;`
+	query := `SELECT c.id, c.postid, COALESCE(c.parentid, 0), COALESCE(c.userid, 0), COALESCE(u.username, ''), c.text, c.like, c.dislike,
+		c.created_at, c.updated_at, c.deleted_at, COALESCE(c.deleted_by, 0), c.delete_reason
+		FROM ` + commentsWithAuthor + ` WHERE c.id=$1;`
 	row := c.db.QueryRow(query, commentID)
 
-	err := row.Scan(&comment.ID, &comment.PostID, &comment.Author, &comment.Text, &comment.Likes, &comment.DisLikes)
+	err := row.Scan(&comment.ID, &comment.PostID, &comment.ParentID, &comment.UserID, &comment.Author, &comment.Text, &comment.Likes, &comment.DisLikes,
+		&createdAt, &updatedAt, &deletedAt, &deletion.By, &deletion.Reason)
 	if err != nil {
-		return models.Comment{}, fmt.Errorf("storage: get user by login: %w", err)
+		return models.Comment{}, fmt.Errorf("storage: get comment by id: %w", err)
+	}
+	comment.CreatedAt, comment.UpdatedAt = createdAt.Time, updatedAt.Time
+	if deletedAt.Valid {
+		deletion.At = deletedAt.Time
+		comment.Deleted = &deletion
 	}
 
 	return comment, nil
 }
 
-func (s *CommentStorage) RemoveLikeComment(commentID int, username string) error {
-	query := `DELETE FROM like WHERE commentId = $1 AND username = $2;`
-	_, err := s.db.Exec(query, commentID, username)
-	if err != nil {
-		return fmt.Errorf("storage: remove like from comment: %w", err)
-	}
-	query = `UPDATE comment SET like = like - 1 WHERE id = $1;`
-	_, err = s.db.Exec(query, commentID)
-	if err != nil {
-		return fmt.Errorf("storage: remove like from comment: %w", err)
+func (c *CommentStorage) SetCommentHTML(commentID int, textHTML string) error {
+	query := `UPDATE comment SET text_html = $1 WHERE id = $2;`
+	if _, err := c.db.Exec(query, textHTML, commentID); err != nil {
+		return fmt.Errorf("storage: set comment html: %w", err)
 	}
 	return nil
 }
 
-func (s *CommentStorage) RemoveDislikeComment(commentID int, username string) error {
-	query := `DELETE FROM dislike WHERE commentId = $1 AND username = $2;`
-	_, err := s.db.Exec(query, commentID, username)
+// UpdateComment gives the comment the text of the revision and records
+// the revision in the same transaction.
+func (c *CommentStorage) UpdateComment(revision *models.CommentRevision, textHTML string) error {
+	tx, err := c.db.Begin()
 	if err != nil {
-		return fmt.Errorf("storage: remove like from comment: %w", err)
+		return fmt.Errorf("storage: update comment: %w", err)
 	}
-	query = `UPDATE comment SET dislike = dislike - 1 WHERE id = $1;`
-	_, err = s.db.Exec(query, commentID)
-	if err != nil {
-		return fmt.Errorf("storage: remove like from comment: %w", err)
+	defer tx.Rollback()
+
+	// The revision goes first so the text the comment was written with
+	// is recorded before it is replaced.
+	if err := createCommentRevision(tx, revision); err != nil {
+		return err
 	}
-	return nil
+	query := `UPDATE comment SET text = $1, text_html = $2, updated_at = $3 WHERE id = $4;`
+	if _, err := tx.Exec(query, revision.Text, textHTML, revision.CreatedAt.UTC(), revision.CommentID); err != nil {
+		return fmt.Errorf("storage: update comment: %w", err)
+	}
+	return tx.Commit()
 }
 
-func (s *CommentStorage) CommentHasLike(commentID int, username string) error {
-	var u, query string
-	query = `SELECT username FROM like WHERE commentId = $1 AND username = $2;`
-	err := s.db.QueryRow(query, commentID, username).Scan(&u)
+// DeleteComment moves the comment to the trash. The points its author
+// earned on it stop counting until it is restored.
+func (c *CommentStorage) DeleteComment(commentID, userID int, reason string, at time.Time) error {
+	tx, err := c.db.Begin()
 	if err != nil {
-		return fmt.Errorf("storage: comment has like: %w", err)
+		return fmt.Errorf("storage: delete comment: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	query := `UPDATE comment SET deleted_at = $1, deleted_by = $2, delete_reason = $3 WHERE id = $4 AND deleted_at IS NULL;`
+	if _, err := tx.Exec(query, at.UTC(), userID, reason, commentID); err != nil {
+		return fmt.Errorf("storage: delete comment: %w", err)
+	}
+	if err := recountReputation(tx, commentEarners, commentID); err != nil {
+		return fmt.Errorf("storage: delete comment: %w", err)
+	}
+	return tx.Commit()
 }
 
-func (s *CommentStorage) CommentHasDislike(commentID int, username string) error {
-	var u, query string
-	query = `SELECT username FROM dislike WHERE commentId = $1 AND username = $2;`
-	err := s.db.QueryRow(query, commentID, username).Scan(&u)
+func (c *CommentStorage) RestoreComment(commentID int) error {
+	tx, err := c.db.Begin()
 	if err != nil {
-		return fmt.Errorf("storage: comment has like: %w", err)
+		return fmt.Errorf("storage: restore comment: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	query := `UPDATE comment SET deleted_at = NULL, deleted_by = NULL, delete_reason = '' WHERE id = $1;`
+	if _, err := tx.Exec(query, commentID); err != nil {
+		return fmt.Errorf("storage: restore comment: %w", err)
+	}
+	if err := recountReputation(tx, commentEarners, commentID); err != nil {
+		return fmt.Errorf("storage: restore comment: %w", err)
+	}
+	return tx.Commit()
 }
 
-func (s *CommentStorage) LikeComment(commentID int, username string) error {
-	query := `INSERT INTO like(commentId, username) VALUES ($1, $2);`
-	_, err := s.db.Exec(query, commentID, username)
+// GetDeletedComments returns the comments in the trash, most recently
+// deleted first. Comments of deleted posts are listed with their post.
+func (c *CommentStorage) GetDeletedComments() ([]*models.Comment, error) {
+	query := `SELECT c.id, c.postid, COALESCE(c.userid, 0), COALESCE(a.username, ''), c.text, c.deleted_at, COALESCE(c.deleted_by, 0), COALESCE(u.username, ''), c.delete_reason
+		FROM comment c LEFT JOIN user a ON a.id = c.userid LEFT JOIN user u ON u.id = c.deleted_by
+		WHERE c.deleted_at IS NOT NULL ORDER BY c.deleted_at DESC;`
+	rows, err := c.db.Query(query)
 	if err != nil {
-		return fmt.Errorf("storage: like comment: %w", err)
+		return nil, fmt.Errorf("storage: get deleted comments: %w", err)
 	}
-	query = `UPDATE comment SET like = like + 1  WHERE id = $1;`
-	_, err = s.db.Exec(query, commentID)
-	if err != nil {
-		return fmt.Errorf("storage: like comment: %w", err)
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var (
+			comment  models.Comment
+			deletion models.Deletion
+		)
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Author, &comment.Text, &deletion.At, &deletion.By, &deletion.ByName, &deletion.Reason); err != nil {
+			return nil, fmt.Errorf("storage: get deleted comments: %w", err)
+		}
+		comment.Deleted = &deletion
+		comments = append(comments, &comment)
 	}
-	return nil
+	return comments, rows.Err()
+}
+
+// GetCommentsDeletedBefore leaves out comments that still have replies. They
+// stay behind as the placeholder of their thread until the replies are
+// purged as well.
+func (c *CommentStorage) GetCommentsDeletedBefore(t time.Time) ([]int, error) {
+	return queryIDs(c.db, `SELECT id FROM comment WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM comment r WHERE r.parentid = comment.id);`, t.UTC())
 }
 
-func (s *CommentStorage) DislikeComment(commentID int, username string) error {
-	query := `INSERT INTO dislike(commentId, username) VALUES ($1, $2);`
-	_, err := s.db.Exec(query, commentID, username)
+// PurgeComment removes the comment for good, with its reactions, the
+// reputation earned on it, its revisions and notifications. A post it
+// answered is left unanswered.
+func (c *CommentStorage) PurgeComment(commentID int) error {
+	tx, err := c.db.Begin()
 	if err != nil {
-		return fmt.Errorf("storage: like comment: %w", err)
+		return fmt.Errorf("storage: purge comment: %w", err)
 	}
-	query = `UPDATE comment SET dislike = dislike + 1  WHERE id = $1;`
-	_, err = s.db.Exec(query, commentID)
-	if err != nil {
-		return fmt.Errorf("storage: like comment: %w", err)
+	defer tx.Rollback()
+
+	// Writing first takes the write lock right away, as in ToggleReaction.
+	if err := dropReputation(tx, `target = 'comment' AND targetid = $1`, commentID); err != nil {
+		return fmt.Errorf("storage: purge comment: %w", err)
 	}
-	return nil
+
+	queries := []string{
+		`DELETE FROM reaction WHERE target = 'comment' AND targetid = $1;`,
+		`DELETE FROM comment_revision WHERE commentid = $1;`,
+		`DELETE FROM notification WHERE commentid = $1;`,
+		`UPDATE post SET accepted_commentid = NULL WHERE accepted_commentid = $1;`,
+		`DELETE FROM comment WHERE id = $1;`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, commentID); err != nil {
+			return fmt.Errorf("storage: purge comment: %w", err)
+		}
+	}
+	return tx.Commit()
 }
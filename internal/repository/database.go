@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
 )
 
 func NewDB() (*sql.DB, error) {
@@ -17,23 +18,324 @@ func NewDB() (*sql.DB, error) {
 }
 
 func CreateTables(db *sql.DB) error {
-	tables := []string{userTable, postTable, commentTable, likeTable, dislikeTable, postCategoryTable}
+	tables := []string{userTable, postTable, commentTable, reactionTable, reactionVoteIndex, postCategoryTable, categoryTable, categoryModeratorTable, categorySeed,
+		groupTable, userGroupTable, categoryPermissionTable, groupSeed,
+		tagTable, postTagTable, imageTable,
+		attachmentTable, allowedTypeTable, allowedTypeSeed, userQuotaTable,
+		postRevisionTable, postRevisionBackfill, commentRevisionTable,
+		notificationTable, userBlockTable, reputationTable, userBadgeTable}
 	for _, v := range tables {
 		_, err := db.Exec(v)
 		if err != nil {
 			return err
 		}
 	}
+
+	for _, c := range addedColumns {
+		if err := addColumn(db, c.table, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range []string{postTimestampBackfill} {
+		if _, err := db.Exec(v); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range usernameColumns {
+		if err := migrateUsername(db, c.table, c.name); err != nil {
+			return err
+		}
+	}
+
+	if err := migrateReactionKey(db); err != nil {
+		return err
+	}
+	return migrateVotes(db)
+}
+
+// addedColumns lists the columns introduced after their table was first
+// created. CreateTables adds them to databases that predate them.
+var addedColumns = []struct {
+	table, name, definition string
+}{
+	{"post", "content_html", "TEXT DEFAULT ''"},
+	{"comment", "text_html", "TEXT DEFAULT ''"},
+	{"post", "deleted_at", "DATETIME DEFAULT NULL"},
+	{"post", "deleted_by", "INTEGER DEFAULT NULL"},
+	{"post", "delete_reason", "TEXT DEFAULT ''"},
+	{"comment", "deleted_at", "DATETIME DEFAULT NULL"},
+	{"comment", "deleted_by", "INTEGER DEFAULT NULL"},
+	{"comment", "delete_reason", "TEXT DEFAULT ''"},
+	{"post", "status", "TEXT DEFAULT 'published'"},
+	{"post", "publish_at", "DATETIME DEFAULT NULL"},
+	{"post", "created_at", "DATETIME DEFAULT NULL"},
+	{"post", "updated_at", "DATETIME DEFAULT NULL"},
+	{"comment", "created_at", "DATETIME DEFAULT NULL"},
+	{"comment", "updated_at", "DATETIME DEFAULT NULL"},
+	{"user", "timezone", "TEXT DEFAULT ''"},
+	{"user", "created_at", "DATETIME DEFAULT NULL"},
+	{"comment", "parentid", "INTEGER DEFAULT NULL"},
+	{"comment", "userid", "INTEGER DEFAULT NULL REFERENCES user(id)"},
+	{"like", "userid", "INTEGER DEFAULT NULL REFERENCES user(id)"},
+	{"dislike", "userid", "INTEGER DEFAULT NULL REFERENCES user(id)"},
+	{"user", "notify_mentions", "INTEGER DEFAULT 1"},
+	{"category", "qa", "INTEGER DEFAULT 0"},
+	{"post", "accepted_commentid", "INTEGER DEFAULT NULL REFERENCES comment(id)"},
+	{"user", "reputation", "INTEGER DEFAULT 0"},
+}
+
+// usernameColumns are the columns that referred to users by name before
+// they were replaced with a userid column. migrateUsername moves them over.
+var usernameColumns = []struct {
+	table, name string
+}{
+	{"comment", "author"},
+	{"like", "username"},
+	{"dislike", "username"},
+}
+
+// addColumn adds the column unless the table has it already. Tables of
+// earlier versions that are gone, such as like and dislike, are skipped.
+func addColumn(db *sql.DB, table, name, definition string) error {
+	exists, err := hasTable(db, table)
+	if err != nil {
+		return fmt.Errorf("storage: add column %s.%s: %w", table, name, err)
+	}
+	if !exists {
+		return nil
+	}
+
+	exists, err = hasColumn(db, table, name)
+	if err != nil {
+		return fmt.Errorf("storage: add column %s.%s: %w", table, name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, name, definition)); err != nil {
+		return fmt.Errorf("storage: add column %s.%s: %w", table, name, err)
+	}
 	return nil
 }
 
+// migrateUsername fills the userid column of the table from the username
+// in the given column and drops that column. Rows naming a user that no
+// longer exists keep a NULL userid.
+func migrateUsername(db *sql.DB, table, name string) error {
+	exists, err := hasColumn(db, table, name)
+	if err != nil || !exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: migrate %s.%s: %w", table, name, err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		fmt.Sprintf("UPDATE %[1]s SET userid = (SELECT id FROM user WHERE username = %[1]s.%[2]s) WHERE userid IS NULL;", table, name),
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, name),
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("storage: migrate %s.%s: %w", table, name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateVotes moves the votes of the like and dislike tables of earlier
+// versions into reaction and drops those tables. Votes of users that no
+// longer exist are dropped, as are second votes of a user on the same post
+// or comment, which the old tables allowed; the like and dislike counters
+// are recounted from what is left.
+func migrateVotes(db *sql.DB) error {
+	exists, err := hasTable(db, "like")
+	if err != nil || !exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: migrate votes: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`INSERT OR IGNORE INTO reaction (userid, target, targetid, kind)
+			SELECT userid, 'post', postid, 'like' FROM like WHERE userid IS NOT NULL AND postid IS NOT NULL AND commentId IS NULL ORDER BY id;`,
+		`INSERT OR IGNORE INTO reaction (userid, target, targetid, kind)
+			SELECT userid, 'comment', commentId, 'like' FROM like WHERE userid IS NOT NULL AND commentId IS NOT NULL ORDER BY id;`,
+		`INSERT OR IGNORE INTO reaction (userid, target, targetid, kind)
+			SELECT userid, 'post', postid, 'dislike' FROM dislike WHERE userid IS NOT NULL AND postid IS NOT NULL AND commentId IS NULL ORDER BY id;`,
+		`INSERT OR IGNORE INTO reaction (userid, target, targetid, kind)
+			SELECT userid, 'comment', commentId, 'dislike' FROM dislike WHERE userid IS NOT NULL AND commentId IS NOT NULL ORDER BY id;`,
+		`UPDATE post SET
+			like = (SELECT COUNT(*) FROM reaction WHERE target = 'post' AND targetid = post.id AND kind = 'like'),
+			dislike = (SELECT COUNT(*) FROM reaction WHERE target = 'post' AND targetid = post.id AND kind = 'dislike');`,
+		`UPDATE comment SET
+			like = (SELECT COUNT(*) FROM reaction WHERE target = 'comment' AND targetid = comment.id AND kind = 'like'),
+			dislike = (SELECT COUNT(*) FROM reaction WHERE target = 'comment' AND targetid = comment.id AND kind = 'dislike');`,
+		`DROP TABLE like;`,
+		`DROP TABLE IF EXISTS dislike;`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("storage: migrate votes: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateReactionKey rebuilds a reaction table that still has the unique
+// key of reactionKeyV1, which leaves no room for emoji reactions.
+func migrateReactionKey(db *sql.DB) error {
+	old, err := hasUniqueKey(db, "reaction", reactionKeyV1...)
+	if err != nil {
+		return fmt.Errorf("storage: migrate reaction key: %w", err)
+	}
+	if !old {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: migrate reaction key: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`ALTER TABLE reaction RENAME TO reaction_v1;`,
+		reactionTable,
+		`INSERT INTO reaction (id, userid, target, targetid, kind, created_at)
+			SELECT id, userid, target, targetid, kind, created_at FROM reaction_v1;`,
+		`DROP TABLE reaction_v1;`,
+		reactionVoteIndex,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("storage: migrate reaction key: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func hasTable(db *sql.DB, name string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1;`, name).Scan(&n)
+	return n > 0, err
+}
+
+// hasUniqueKey tells whether the table has a UNIQUE constraint on exactly
+// the columns, in that order. Unique indexes made with CREATE INDEX are
+// not constraints and don't count.
+func hasUniqueKey(db *sql.DB, table string, columns ...string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_list(%s);", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var (
+			seq, unique, partial int
+			name, origin         string
+		)
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			return false, err
+		}
+		if unique == 1 && origin == "u" {
+			keys = append(keys, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		indexed, err := indexColumns(db, key)
+		if err != nil {
+			return false, err
+		}
+		if len(indexed) != len(columns) {
+			continue
+		}
+		same := true
+		for i := range columns {
+			if indexed[i] != columns[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// indexColumns returns the columns of the index in index order.
+func indexColumns(db *sql.DB, index string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_info(%s);", index))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var (
+			seqno, cid int
+			name       sql.NullString
+		)
+		if err := rows.Scan(&seqno, &cid, &name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name.String)
+	}
+	return columns, rows.Err()
+}
+
+func hasColumn(db *sql.DB, table, name string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			column, kind     string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &column, &kind, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if column == name {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 const userTable = `CREATE TABLE IF NOT EXISTS user (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	email TEXT UNIQUE,
 	username TEXT UNIQUE,
 	password TEXT,
 	token TEXT DEFAULT NULL,
-	expiresAt DATETIME DEFAULT NULL
+	expiresAt DATETIME DEFAULT NULL,
+	timezone TEXT DEFAULT '',
+	created_at DATETIME DEFAULT NULL,
+	notify_mentions INTEGER DEFAULT 1,
+	reputation INTEGER DEFAULT 0
 );`
 
 const postTable = `CREATE TABLE IF NOT EXISTS post (
@@ -45,7 +347,16 @@ const postTable = `CREATE TABLE IF NOT EXISTS post (
 	category TEXT,
 	like INTEGER DEFAULT 0,
 	dislike INTEGER DEFAULT 0,
-	userliked INTEGER Default 0
+	userliked INTEGER Default 0,
+	content_html TEXT DEFAULT '',
+	deleted_at DATETIME DEFAULT NULL,
+	deleted_by INTEGER DEFAULT NULL,
+	delete_reason TEXT DEFAULT '',
+	status TEXT DEFAULT 'published',
+	publish_at DATETIME DEFAULT NULL,
+	created_at DATETIME DEFAULT NULL,
+	updated_at DATETIME DEFAULT NULL,
+	accepted_commentid INTEGER DEFAULT NULL REFERENCES comment(id)
 );`
 
 const postCategoryTable = `CREATE TABLE IF NOT EXISTS post_category (
@@ -54,25 +365,251 @@ const postCategoryTable = `CREATE TABLE IF NOT EXISTS post_category (
 	FOREIGN KEY (postID) REFERENCES post(id) ON DELETE CASCADE
 );`
 
-const commentTable = `CREATE TABLE IF NOT EXISTS comment (
+const categoryTable = `CREATE TABLE IF NOT EXISTS category (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	parentid INTEGER DEFAULT NULL,
+	name TEXT UNIQUE,
+	description TEXT DEFAULT '',
+	position INTEGER DEFAULT 0,
+	qa INTEGER DEFAULT 0,
+	FOREIGN KEY (parentid) REFERENCES category(id) ON DELETE CASCADE
+);`
+
+const categoryModeratorTable = `CREATE TABLE IF NOT EXISTS category_moderator (
+	categoryid INTEGER,
+	userid INTEGER,
+	UNIQUE (categoryid, userid),
+	FOREIGN KEY (categoryid) REFERENCES category(id) ON DELETE CASCADE,
+	FOREIGN KEY (userid) REFERENCES user(id) ON DELETE CASCADE
+);`
+
+// categorySeed creates the default board tree. Subforum names match the
+// categories stored in post_category.
+const categorySeed = `INSERT OR IGNORE INTO category (name, description, position) VALUES
+	('Programming', 'Languages and everything around them', 1),
+	('Infrastructure', 'Containers, databases and deployment', 2);
+INSERT OR IGNORE INTO category (parentid, name, description, position) VALUES
+	((SELECT id FROM category WHERE name = 'Programming'), 'Golang', 'Go language, tooling and libraries', 1),
+	((SELECT id FROM category WHERE name = 'Programming'), 'Python', 'Python scripts, frameworks and packaging', 2),
+	((SELECT id FROM category WHERE name = 'Programming'), 'JavaScript', 'Browser and Node.js development', 3),
+	((SELECT id FROM category WHERE name = 'Infrastructure'), 'Docker', 'Images, containers and orchestration', 1),
+	((SELECT id FROM category WHERE name = 'Infrastructure'), 'SQL', 'Queries, schemas and database engines', 2);`
+
+const groupTable = `CREATE TABLE IF NOT EXISTS usergroup (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT UNIQUE
+);`
+
+const userGroupTable = `CREATE TABLE IF NOT EXISTS user_group (
+	userid INTEGER,
+	groupid INTEGER,
+	UNIQUE (userid, groupid),
+	FOREIGN KEY (userid) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (groupid) REFERENCES usergroup(id) ON DELETE CASCADE
+);`
+
+// A category without any rows in category_permission is public. Once a
+// category has rows, only the listed groups get the granted rights.
+const categoryPermissionTable = `CREATE TABLE IF NOT EXISTS category_permission (
+	categoryid INTEGER,
+	groupid INTEGER,
+	canread INTEGER DEFAULT 0,
+	canpost INTEGER DEFAULT 0,
+	canmoderate INTEGER DEFAULT 0,
+	UNIQUE (categoryid, groupid),
+	FOREIGN KEY (categoryid) REFERENCES category(id) ON DELETE CASCADE,
+	FOREIGN KEY (groupid) REFERENCES usergroup(id) ON DELETE CASCADE
+);`
+
+const groupSeed = `INSERT OR IGNORE INTO usergroup (name) VALUES ('admin');`
+
+// A tag with synonymof set is an alias merged into another tag.
+const tagTable = `CREATE TABLE IF NOT EXISTS tag (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT UNIQUE,
+	synonymof INTEGER DEFAULT NULL,
+	FOREIGN KEY (synonymof) REFERENCES tag(id) ON DELETE SET NULL
+);`
+
+const postTagTable = `CREATE TABLE IF NOT EXISTS post_tag (
+	postid INTEGER,
+	tagid INTEGER,
+	UNIQUE (postid, tagid),
+	FOREIGN KEY (postid) REFERENCES post(id) ON DELETE CASCADE,
+	FOREIGN KEY (tagid) REFERENCES tag(id) ON DELETE CASCADE
+);`
+
+// Images are stored on disk under their content hash. Identical uploads
+// share one file, referenced by several rows.
+const imageTable = `CREATE TABLE IF NOT EXISTS image (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	author TEXT,
 	postid INTEGER,
+	filename TEXT,
+	contenttype TEXT,
+	width INTEGER,
+	height INTEGER,
+	size INTEGER,
+	FOREIGN KEY (postid) REFERENCES post(id) ON DELETE CASCADE
+);`
+
+// Attachments of a comment keep the postid of the comment as well, so all
+// files of a thread can be found and removed with one query.
+const attachmentTable = `CREATE TABLE IF NOT EXISTS attachment (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userid INTEGER,
+	postid INTEGER,
+	commentid INTEGER DEFAULT NULL,
+	name TEXT,
+	blobkey TEXT,
+	contenttype TEXT,
+	size INTEGER,
+	downloads INTEGER DEFAULT 0,
+	FOREIGN KEY (userid) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (postid) REFERENCES post(id) ON DELETE CASCADE,
+	FOREIGN KEY (commentid) REFERENCES comment(id) ON DELETE CASCADE
+);`
+
+// allowed_type lists the MIME types users may attach, as managed by
+// administrators at /admin/attachments.
+const allowedTypeTable = `CREATE TABLE IF NOT EXISTS allowed_type (
+	mimetype TEXT PRIMARY KEY
+);`
+
+// allowedTypeSeed is only applied while the list is empty, so types an
+// administrator removed stay removed.
+const allowedTypeSeed = `INSERT INTO allowed_type (mimetype)
+	SELECT * FROM (VALUES ('application/pdf'), ('text/plain'), ('application/zip'), ('application/x-gzip'))
+	WHERE NOT EXISTS (SELECT 1 FROM allowed_type);`
+
+// user_quota overrides the default attachment quota for single users.
+const userQuotaTable = `CREATE TABLE IF NOT EXISTS user_quota (
+	userid INTEGER PRIMARY KEY,
+	quota INTEGER,
+	FOREIGN KEY (userid) REFERENCES user(id) ON DELETE CASCADE
+);`
+
+// post_revision keeps every saved state of a post, the current one
+// included, so edits can be compared and rolled back.
+const postRevisionTable = `CREATE TABLE IF NOT EXISTS post_revision (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	postid INTEGER,
+	editorid INTEGER,
+	createdat DATETIME DEFAULT NULL,
+	title TEXT,
+	content TEXT,
+	reason TEXT DEFAULT '',
+	FOREIGN KEY (postid) REFERENCES post(id) ON DELETE CASCADE
+);`
+
+// comment_revision keeps the saved states of edited comments. Comments
+// that were never edited have no revisions.
+const commentRevisionTable = `CREATE TABLE IF NOT EXISTS comment_revision (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	commentid INTEGER,
+	editorid INTEGER,
+	created_at DATETIME DEFAULT NULL,
 	text TEXT,
-	like INTEGER DEFAULT 0,
-	dislike INTEGER DEFAULT 0
+	reason TEXT DEFAULT '',
+	FOREIGN KEY (commentid) REFERENCES comment(id) ON DELETE CASCADE
 );`
 
-const likeTable = `CREATE TABLE IF NOT EXISTS like (
+// notification holds what users are told about, such as being mentioned.
+// read_at stays NULL until the user has seen it.
+const notificationTable = `CREATE TABLE IF NOT EXISTS notification (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	username TEXT,
+	userid INTEGER,
+	actorid INTEGER,
+	kind TEXT,
 	postid INTEGER,
-	commentId INTEGER DEFAULT NULL
+	commentid INTEGER DEFAULT NULL,
+	created_at DATETIME DEFAULT NULL,
+	read_at DATETIME DEFAULT NULL,
+	FOREIGN KEY (userid) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (postid) REFERENCES post(id) ON DELETE CASCADE
 );`
 
-const dislikeTable = `CREATE TABLE IF NOT EXISTS dislike(
+// user_block lists the users each user has blocked. Blocked users cannot
+// notify the user who blocked them.
+const userBlockTable = `CREATE TABLE IF NOT EXISTS user_block (
+	userid INTEGER,
+	blockedid INTEGER,
+	PRIMARY KEY (userid, blockedid),
+	FOREIGN KEY (userid) REFERENCES user(id) ON DELETE CASCADE,
+	FOREIGN KEY (blockedid) REFERENCES user(id) ON DELETE CASCADE
+);`
+
+// reputationTable records the points each like or dislike earned the
+// author of a post or comment, so taking the vote back takes back exactly
+// those points. The reputation column of user sums the rows up. A vote on
+// one's own post or comment gets a row worth nothing.
+const reputationTable = `CREATE TABLE IF NOT EXISTS reputation (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	username TEXT,
+	userid INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+	actorid INTEGER NOT NULL,
+	target TEXT NOT NULL,
+	targetid INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	points INTEGER NOT NULL,
+	created_at DATETIME DEFAULT NULL,
+	UNIQUE (actorid, target, targetid)
+);`
+
+// userBadgeTable holds the badges awarded to users, by the slug of the
+// badge. The badges themselves are defined in code.
+const userBadgeTable = `CREATE TABLE IF NOT EXISTS user_badge (
+	userid INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+	badge TEXT NOT NULL,
+	awarded_at DATETIME DEFAULT NULL,
+	PRIMARY KEY (userid, badge)
+);`
+
+// postRevisionBackfill gives posts written before revisions were kept a
+// first revision holding their current state. Its time stays unknown.
+const postRevisionBackfill = `INSERT INTO post_revision (postid, editorid, title, content)
+	SELECT id, userid, title, content FROM post
+	WHERE id NOT IN (SELECT postid FROM post_revision);`
+
+// postTimestampBackfill dates posts written before they had timestamps
+// from their revisions. It runs after the columns are added; posts whose
+// revisions are undated too keep NULL and are shown without a time.
+const postTimestampBackfill = `UPDATE post SET
+	created_at = (SELECT MIN(createdat) FROM post_revision WHERE postid = post.id),
+	updated_at = (SELECT MAX(createdat) FROM post_revision WHERE postid = post.id)
+	WHERE created_at IS NULL;`
+
+const commentTable = `CREATE TABLE IF NOT EXISTS comment (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userid INTEGER DEFAULT NULL REFERENCES user(id),
 	postid INTEGER,
-	commentId INTEGER DEFAULT NULL
+	text TEXT,
+	like INTEGER DEFAULT 0,
+	dislike INTEGER DEFAULT 0,
+	text_html TEXT DEFAULT '',
+	deleted_at DATETIME DEFAULT NULL,
+	deleted_by INTEGER DEFAULT NULL,
+	delete_reason TEXT DEFAULT '',
+	created_at DATETIME DEFAULT NULL,
+	updated_at DATETIME DEFAULT NULL,
+	parentid INTEGER DEFAULT NULL
 );`
+
+// reactionTable holds the likes, dislikes and emoji reactions of posts and
+// comments. The kind is "like", "dislike" or the emoji itself. A user uses
+// each emoji at most once on a target and either likes or dislikes it, as
+// reactionVoteIndex enforces. The like and dislike columns of post and
+// comment count the rows.
+const reactionTable = `CREATE TABLE IF NOT EXISTS reaction (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userid INTEGER NOT NULL REFERENCES user(id),
+	target TEXT NOT NULL CHECK (target IN ('post', 'comment')),
+	targetid INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	created_at DATETIME DEFAULT NULL,
+	UNIQUE (userid, target, targetid, kind)
+);`
+
+const reactionVoteIndex = `CREATE UNIQUE INDEX IF NOT EXISTS reaction_vote ON reaction (userid, target, targetid) WHERE kind IN ('like', 'dislike');`
+
+// reactionKeyV1 holds the columns of the unique key of reaction before
+// emoji reactions, which allowed a single reaction per user and target.
+var reactionKeyV1 = []string{"userid", "target", "targetid"}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+)
+
+type Image interface {
+	GetImagesByPostID(postID int) ([]models.Image, error)
+	DeleteImagesByPostID(postID int, remove func(filename string) error) error
+	GetPostIDsByFilename(filename string) ([]int, error)
+}
+
+type ImageStorage struct {
+	db *sql.DB
+}
+
+func NewImageSqlite(db *sql.DB) *ImageStorage {
+	return &ImageStorage{db: db}
+}
+
+// createImages writes the images of the post inside the transaction that
+// creates it.
+func createImages(tx *sql.Tx, postID int, images []*models.Image) error {
+	query := `INSERT INTO image (postid, filename, contenttype, width, height, size) VALUES ($1, $2, $3, $4, $5, $6);`
+	for _, image := range images {
+		image.PostID = postID
+		result, err := tx.Exec(query, image.PostID, image.Filename, image.ContentType, image.Width, image.Height, image.Size)
+		if err != nil {
+			return fmt.Errorf("storage: create image: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("storage: create image: %w", err)
+		}
+		image.ID = int(id)
+	}
+	return nil
+}
+
+func (s *ImageStorage) GetImagesByPostID(postID int) ([]models.Image, error) {
+	query := `SELECT id, postid, filename, contenttype, width, height, size FROM image WHERE postid = $1 ORDER BY id;`
+	rows, err := s.db.Query(query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get images by post id: %w", err)
+	}
+	defer rows.Close()
+
+	var images []models.Image
+	for rows.Next() {
+		var i models.Image
+		if err := rows.Scan(&i.ID, &i.PostID, &i.Filename, &i.ContentType, &i.Width, &i.Height, &i.Size); err != nil {
+			return nil, fmt.Errorf("storage: get images by post id: %w", err)
+		}
+		images = append(images, i)
+	}
+	return images, nil
+}
+
+// DeleteImagesByPostID removes the images of the post and calls remove,
+// in the same transaction, for every stored file no other post uses.
+func (s *ImageStorage) DeleteImagesByPostID(postID int, remove func(filename string) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: delete images by post id: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteUnreferenced(tx, remove, `DELETE FROM image WHERE postid = $1 RETURNING filename;`, postID); err != nil {
+		return fmt.Errorf("storage: delete images by post id: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetPostIDsByFilename returns the posts that use the stored file. One
+// file can belong to several posts, as identical uploads share it.
+func (s *ImageStorage) GetPostIDsByFilename(filename string) ([]int, error) {
+	ids, err := queryIDs(s.db, `SELECT DISTINCT postid FROM image WHERE filename = $1;`, filename)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get post ids by filename: %w", err)
+	}
+	return ids, nil
+}
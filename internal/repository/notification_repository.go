@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+type Notification interface {
+	CreateNotification(notification *models.Notification) error
+	GetNotifications(userID, limit int) ([]models.Notification, error)
+	MarkNotificationsRead(userID int, at time.Time) error
+	BlockUser(userID, blockedID int) error
+	UnblockUser(userID, blockedID int) error
+	IsBlocked(userID, blockedID int) (bool, error)
+	GetBlockedUsers(userID int) ([]models.User, error)
+}
+
+type NotificationStorage struct {
+	db *sql.DB
+}
+
+func NewNotificationSqlite(db *sql.DB) *NotificationStorage {
+	return &NotificationStorage{db: db}
+}
+
+func (s *NotificationStorage) CreateNotification(notification *models.Notification) error {
+	query := `INSERT INTO notification (userid, actorid, kind, postid, commentid, created_at) VALUES ($1, $2, $3, $4, $5, $6);`
+	result, err := s.db.Exec(query, notification.UserID, notification.ActorID, notification.Kind, notification.PostID,
+		nullInt(notification.CommentID), nullTime(notification.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("storage: create notification: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("storage: create notification: %w", err)
+	}
+	notification.ID = int(id)
+	return nil
+}
+
+// visibleNotification tells whether notification n is about a post, and
+// comment if any, that is neither in the trash nor unpublished.
+const visibleNotification = `EXISTS (SELECT 1 FROM post vp WHERE vp.id = n.postid AND vp.deleted_at IS NULL AND vp.status = 'published')
+	AND (n.commentid IS NULL OR EXISTS (SELECT 1 FROM comment vc WHERE vc.id = n.commentid AND vc.deleted_at IS NULL))`
+
+// GetNotifications returns the latest notifications of the user, newest
+// first. Notifications about posts and comments that are gone, in the
+// trash or unpublished are left out.
+func (s *NotificationStorage) GetNotifications(userID, limit int) ([]models.Notification, error) {
+	query := `SELECT n.id, n.userid, n.actorid, COALESCE(u.username, ''), n.kind, n.postid, p.title, COALESCE(n.commentid, 0), n.created_at, n.read_at IS NOT NULL
+		FROM notification n JOIN post p ON p.id = n.postid LEFT JOIN user u ON u.id = n.actorid
+		WHERE n.userid = $1 AND ` + visibleNotification + `
+		ORDER BY n.id DESC LIMIT $2;`
+	rows, err := s.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var (
+			n         models.Notification
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.Actor, &n.Kind, &n.PostID, &n.PostTitle, &n.CommentID, &createdAt, &n.Read); err != nil {
+			return nil, fmt.Errorf("storage: get notifications: %w", err)
+		}
+		n.CreatedAt = createdAt.Time
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *NotificationStorage) MarkNotificationsRead(userID int, at time.Time) error {
+	query := `UPDATE notification SET read_at = $1 WHERE userid = $2 AND read_at IS NULL;`
+	if _, err := s.db.Exec(query, at.UTC(), userID); err != nil {
+		return fmt.Errorf("storage: mark notifications read: %w", err)
+	}
+	return nil
+}
+
+func (s *NotificationStorage) BlockUser(userID, blockedID int) error {
+	query := `INSERT OR IGNORE INTO user_block (userid, blockedid) VALUES ($1, $2);`
+	if _, err := s.db.Exec(query, userID, blockedID); err != nil {
+		return fmt.Errorf("storage: block user: %w", err)
+	}
+	return nil
+}
+
+func (s *NotificationStorage) UnblockUser(userID, blockedID int) error {
+	query := `DELETE FROM user_block WHERE userid = $1 AND blockedid = $2;`
+	if _, err := s.db.Exec(query, userID, blockedID); err != nil {
+		return fmt.Errorf("storage: unblock user: %w", err)
+	}
+	return nil
+}
+
+func (s *NotificationStorage) IsBlocked(userID, blockedID int) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM user_block WHERE userid = $1 AND blockedid = $2);`
+	var blocked bool
+	if err := s.db.QueryRow(query, userID, blockedID).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("storage: is blocked: %w", err)
+	}
+	return blocked, nil
+}
+
+// GetBlockedUsers returns the users the user has blocked, by name.
+func (s *NotificationStorage) GetBlockedUsers(userID int) ([]models.User, error) {
+	query := `SELECT u.id, u.username FROM user_block b JOIN user u ON u.id = b.blockedid
+		WHERE b.userid = $1 ORDER BY u.username;`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, fmt.Errorf("storage: get blocked users: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
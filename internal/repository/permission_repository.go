@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+)
+
+type Permission interface {
+	CreateGroup(name string) error
+	GetGroups() ([]models.Group, error)
+	GetGroupByName(name string) (models.Group, error)
+	GetGroupMembers(groupID int) ([]models.User, error)
+	GetUserGroupIDs(userID int) ([]int, error)
+	AddUserToGroup(userID, groupID int) error
+	RemoveUserFromGroup(userID, groupID int) error
+	GetCategoryPermissions() ([]models.CategoryPermission, error)
+	SetCategoryPermission(perm models.CategoryPermission) error
+	DeleteCategoryPermission(categoryID, groupID int) error
+}
+
+type PermissionStorage struct {
+	db *sql.DB
+}
+
+func NewPermissionSqlite(db *sql.DB) *PermissionStorage {
+	return &PermissionStorage{db: db}
+}
+
+func (s *PermissionStorage) CreateGroup(name string) error {
+	query := `INSERT INTO usergroup (name) VALUES ($1);`
+	if _, err := s.db.Exec(query, name); err != nil {
+		return fmt.Errorf("storage: create group: %w", err)
+	}
+	return nil
+}
+
+func (s *PermissionStorage) GetGroups() ([]models.Group, error) {
+	rows, err := s.db.Query(`SELECT id, name FROM usergroup ORDER BY name;`)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var g models.Group
+		if err := rows.Scan(&g.ID, &g.Name); err != nil {
+			return nil, fmt.Errorf("storage: get groups: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (s *PermissionStorage) GetGroupByName(name string) (models.Group, error) {
+	var g models.Group
+	query := `SELECT id, name FROM usergroup WHERE name = $1;`
+	if err := s.db.QueryRow(query, name).Scan(&g.ID, &g.Name); err != nil {
+		return models.Group{}, fmt.Errorf("storage: get group by name: %w", err)
+	}
+	return g, nil
+}
+
+func (s *PermissionStorage) GetGroupMembers(groupID int) ([]models.User, error) {
+	query := `SELECT u.id, u.username FROM user_group ug JOIN user u ON u.id = ug.userid WHERE ug.groupid = $1 ORDER BY u.username;`
+	rows, err := s.db.Query(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get group members: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, fmt.Errorf("storage: get group members: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (s *PermissionStorage) GetUserGroupIDs(userID int) ([]int, error) {
+	rows, err := s.db.Query(`SELECT groupid FROM user_group WHERE userid = $1;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get user groups: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("storage: get user groups: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *PermissionStorage) AddUserToGroup(userID, groupID int) error {
+	query := `INSERT OR IGNORE INTO user_group (userid, groupid) VALUES ($1, $2);`
+	if _, err := s.db.Exec(query, userID, groupID); err != nil {
+		return fmt.Errorf("storage: add user to group: %w", err)
+	}
+	return nil
+}
+
+func (s *PermissionStorage) RemoveUserFromGroup(userID, groupID int) error {
+	query := `DELETE FROM user_group WHERE userid = $1 AND groupid = $2;`
+	if _, err := s.db.Exec(query, userID, groupID); err != nil {
+		return fmt.Errorf("storage: remove user from group: %w", err)
+	}
+	return nil
+}
+
+func (s *PermissionStorage) GetCategoryPermissions() ([]models.CategoryPermission, error) {
+	query := `SELECT cp.categoryid, c.name, cp.groupid, g.name, cp.canread, cp.canpost, cp.canmoderate
+	FROM category_permission cp
+	JOIN category c ON c.id = cp.categoryid
+	JOIN usergroup g ON g.id = cp.groupid
+	ORDER BY c.name, g.name;`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get category permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var perms []models.CategoryPermission
+	for rows.Next() {
+		var p models.CategoryPermission
+		if err := rows.Scan(&p.CategoryID, &p.CategoryName, &p.GroupID, &p.GroupName, &p.CanRead, &p.CanPost, &p.CanModerate); err != nil {
+			return nil, fmt.Errorf("storage: get category permissions: %w", err)
+		}
+		perms = append(perms, p)
+	}
+	return perms, nil
+}
+
+func (s *PermissionStorage) SetCategoryPermission(p models.CategoryPermission) error {
+	query := `INSERT INTO category_permission (categoryid, groupid, canread, canpost, canmoderate) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (categoryid, groupid) DO UPDATE SET canread = excluded.canread, canpost = excluded.canpost, canmoderate = excluded.canmoderate;`
+	if _, err := s.db.Exec(query, p.CategoryID, p.GroupID, p.CanRead, p.CanPost, p.CanModerate); err != nil {
+		return fmt.Errorf("storage: set category permission: %w", err)
+	}
+	return nil
+}
+
+func (s *PermissionStorage) DeleteCategoryPermission(categoryID, groupID int) error {
+	query := `DELETE FROM category_permission WHERE categoryid = $1 AND groupid = $2;`
+	if _, err := s.db.Exec(query, categoryID, groupID); err != nil {
+		return fmt.Errorf("storage: delete category permission: %w", err)
+	}
+	return nil
+}
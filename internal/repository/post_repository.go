@@ -4,25 +4,32 @@ import (
 	"database/sql"
 	"fmt"
 	"forum/internal/models"
-	"log"
+	"html/template"
+	"time"
 )
 
 type PostItem interface {
-	CreatePost(post *models.Post) error
+	CreatePost(post *models.Post, files Files) error
 	GetAllPosts() (posts []models.Post, err error)
 	GetPostByID(id int) (models.Post, error)
 	GetPostsByCategory(category string) ([]models.Post, error)
+	GetPostsByTag(tagID int) ([]models.Post, error)
 	GetCreatedPosts(userID int) ([]models.Post, error)
-	GetLikedPosts(username string) ([]models.Post, error)
+	GetLikedPosts(userID int) ([]models.Post, error)
 	GetCategoriesByPostID(postId int) ([]string, error)
-	UpdatePost(id, like, dislike int, title, content string) error
-	DeletePost(id int) error
-	LikePost(username string, postid int) error
-	DisLikePost(username string, postid int) error
-	RemoveLikePost(id int) error
-	RemoveDisLikePost(id int) error
-	HasUserLiked(username string, postid int) error
-	HasUserDislike(username string, postid int) error
+	UpdatePost(revision *models.PostRevision, contentHTML string) error
+	SetPostHTML(id int, contentHTML string) error
+	DeletePost(id, userID int, reason string, at time.Time) error
+	RestorePost(id int) error
+	GetDeletedPosts() ([]models.Post, error)
+	GetPostsDeletedBefore(t time.Time) ([]int, error)
+	PurgePost(id int) error
+	GetDraftPosts(userID int) ([]models.Post, error)
+	SetPostStatus(id int, status string, publishAt time.Time) error
+	PublishDuePosts(now time.Time) ([]int, error)
+	SetAcceptedAnswer(postID, commentID int) error
+	GetUnansweredPostsByCategory(category string) ([]models.Post, error)
+	GetOrphanedPostIDs() ([]int, error)
 }
 
 type PostStorage struct {
@@ -33,102 +40,193 @@ func NewPostSqlite(db *sql.DB) *PostStorage {
 	return &PostStorage{db: db}
 }
 
-func (p *PostStorage) CreatePost(post *models.Post) error {
-	query := fmt.Sprintf(`INSERT INTO post (userid, title, content, about) values ($1, $2, $3, $4)`)
-	result, err := p.db.Exec(query, post.UserID, post.Title, post.Content, post.About)
+// CreatePost stores the post with its categories, its tags, its first
+// revision and its files in one transaction. Unknown tags are created and
+// synonyms are replaced with the tags they were merged into.
+func (p *PostStorage) CreatePost(post *models.Post, files Files) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: create post: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`INSERT INTO post (userid, title, content, content_html, about, status, publish_at, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	result, err := tx.Exec(query, post.UserID, post.Title, post.Content, string(post.ContentHTML), post.About, post.Status, nullTime(post.PublishAt),
+		nullTime(post.CreatedAt), nullTime(post.UpdatedAt))
 	if err != nil {
 		return fmt.Errorf("storage: create post: %w", err)
 	}
 	postId, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("storage: create post: %w", err)
+	}
 
 	query = `INSERT INTO post_category (postId, category) VALUES ($1, $2);`
 	for _, oneCategory := range post.Category {
-		_, err := p.db.Exec(query, postId, oneCategory)
+		_, err := tx.Exec(query, postId, oneCategory)
 		if err != nil {
 			return fmt.Errorf("storage: create post: %w", err)
 		}
 	}
+
+	for _, tag := range post.Tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tag (name) VALUES ($1);`, tag); err != nil {
+			return fmt.Errorf("storage: create post: %w", err)
+		}
+		query = `INSERT OR IGNORE INTO post_tag (postid, tagid) SELECT $1, COALESCE(synonymof, id) FROM tag WHERE name = $2;`
+		if _, err := tx.Exec(query, postId, tag); err != nil {
+			return fmt.Errorf("storage: create post: %w", err)
+		}
+	}
+
+	revision := &models.PostRevision{
+		PostID:    int(postId),
+		EditorID:  post.UserID,
+		CreatedAt: post.CreatedAt,
+		Title:     post.Title,
+		Content:   post.Content,
+	}
+	if err := createRevision(tx, revision); err != nil {
+		return err
+	}
+
+	if err := createFiles(tx, int(postId), 0, files); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("storage: create post: %w", err)
+	}
+	post.Id = int(postId)
 	return nil
 }
 
-func (p *PostStorage) GetAllPosts() ([]models.Post, error) {
-	var posts []models.Post
-	rows, err := p.db.Query("SELECT id, userid, title, content, about FROM post")
+// postColumns are the columns listings select, in the order queryPosts
+// reads them. Listings select FROM postsWithAuthor.
+const postColumns = `p.id, p.userid, COALESCE(u.username, ''), COALESCE(u.reputation, 0), p.title, p.content, p.about, p.like, p.dislike, ` + commentCount + `,
+	` + isQuestion + `, ` + acceptedAnswer + `, p.created_at, p.updated_at`
+
+// commentCount counts the comments of post p that are not in the trash.
+const commentCount = `(SELECT COUNT(*) FROM comment WHERE comment.postid = p.id AND comment.deleted_at IS NULL)`
+
+// isQuestion tells whether post p is filed under a Q&A category.
+const isQuestion = `EXISTS (SELECT 1 FROM post_category pc JOIN category qc ON qc.name = pc.category WHERE pc.postID = p.id AND qc.qa = 1)`
+
+// acceptedAnswer is the id of the accepted answer to post p, or 0 when
+// there is none or it is in the trash.
+const acceptedAnswer = `COALESCE((SELECT ac.id FROM comment ac WHERE ac.id = p.accepted_commentid AND ac.deleted_at IS NULL), 0)`
+
+// postsWithAuthor joins every post with its author.
+const postsWithAuthor = `post p LEFT JOIN user u ON u.id = p.userid`
+
+// queryPosts runs a listing query selecting postColumns. Listings show
+// the newest posts first; posts without a time go last.
+func (p *PostStorage) queryPosts(query string, args ...interface{}) ([]models.Post, error) {
+	rows, err := p.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("storage: get all posts: query - %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
+	var posts []models.Post
 	for rows.Next() {
-		p := models.Post{}
-		if err = rows.Scan(&p.Id, &p.UserID, &p.Title, &p.Content, &p.About); err != nil {
-			return posts, err
+		var (
+			post                 models.Post
+			createdAt, updatedAt sql.NullTime
+		)
+		if err := rows.Scan(&post.Id, &post.UserID, &post.Author, &post.AuthorReputation, &post.Title, &post.Content, &post.About, &post.Like, &post.DisLike, &post.Comments,
+			&post.Question, &post.AcceptedID, &createdAt, &updatedAt); err != nil {
+			return nil, err
 		}
-		posts = append(posts, p)
+		post.CreatedAt, post.UpdatedAt = createdAt.Time, updatedAt.Time
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (p *PostStorage) GetAllPosts() ([]models.Post, error) {
+	posts, err := p.queryPosts(`SELECT ` + postColumns + ` FROM ` + postsWithAuthor + ` WHERE p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY p.created_at DESC, p.id DESC;`)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get all posts: %w", err)
 	}
-	rows.Close()
 	return posts, nil
 }
 
 func (s *PostStorage) GetPostsByCategory(category string) ([]models.Post, error) {
-	var p []models.Post
-	query := `SELECT id, userid, title, content, about, like, dislike FROM post WHERE id IN (SELECT postId FROM post_category WHERE category=$1);`
-	rows, err := s.db.Query(query, category)
+	posts, err := s.queryPosts(`SELECT `+postColumns+` FROM `+postsWithAuthor+` WHERE p.id IN (SELECT postId FROM post_category WHERE category=$1) AND p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY p.created_at DESC, p.id DESC;`, category)
 	if err != nil {
 		return nil, fmt.Errorf("storage: get post by category: %w", err)
 	}
-	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.Id, &post.UserID, &post.Title, &post.Content, &post.About, &post.Like, &post.DisLike); err != nil {
-			return nil, fmt.Errorf("storage: get post by category: %w", err)
-		}
-		p = append(p, post)
-	}
-	return p, nil
+	return posts, nil
 }
 
-func (p *PostStorage) GetCreatedPosts(userID int) ([]models.Post, error) {
-	var posts []models.Post
-	rows, err := p.db.Query("SELECT id, userid, title, content, about FROM post WHERE userid=$1", userID)
+// GetUnansweredPostsByCategory returns the published posts of the category
+// without an accepted answer.
+func (s *PostStorage) GetUnansweredPostsByCategory(category string) ([]models.Post, error) {
+	posts, err := s.queryPosts(`SELECT `+postColumns+` FROM `+postsWithAuthor+` WHERE p.id IN (SELECT postId FROM post_category WHERE category=$1) AND p.deleted_at IS NULL AND p.status = 'published'
+		AND `+acceptedAnswer+` = 0
+		ORDER BY p.created_at DESC, p.id DESC;`, category)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("storage: get unanswered posts by category: %w", err)
 	}
+	return posts, nil
+}
 
-	for rows.Next() {
-		p := models.Post{}
-		if err := rows.Scan(&p.Id, &p.UserID, &p.Title, &p.Content, &p.About); err != nil {
-			return posts, err
-		}
-		posts = append(posts, p)
+func (s *PostStorage) GetPostsByTag(tagID int) ([]models.Post, error) {
+	posts, err := s.queryPosts(`SELECT `+postColumns+` FROM `+postsWithAuthor+` WHERE p.id IN (SELECT postid FROM post_tag WHERE tagid=$1) AND p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY p.created_at DESC, p.id DESC;`, tagID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get posts by tag: %w", err)
 	}
-	rows.Close()
 	return posts, nil
 }
 
-func (p *PostStorage) GetLikedPosts(username string) ([]models.Post, error) {
-	var posts []models.Post
-	rows, err := p.db.Query("SELECT id, userid, title, content, about FROM post WHERE id IN (SELECT postid FROM like WHERE username=$1);", username)
+func (p *PostStorage) GetCreatedPosts(userID int) ([]models.Post, error) {
+	posts, err := p.queryPosts(`SELECT `+postColumns+` FROM `+postsWithAuthor+` WHERE p.userid=$1 AND p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY p.created_at DESC, p.id DESC;`, userID)
 	if err != nil {
-		return nil, err
-	}
-	for rows.Next() {
-		p := models.Post{}
-		if err := rows.Scan(&p.Id, &p.UserID, &p.Title, &p.Content, &p.About); err != nil {
-			return posts, err
-		}
-		posts = append(posts, p)
+		return nil, fmt.Errorf("storage: get created posts: %w", err)
 	}
+	return posts, nil
+}
 
-	rows.Close()
+func (p *PostStorage) GetLikedPosts(userID int) ([]models.Post, error) {
+	posts, err := p.queryPosts(`SELECT `+postColumns+` FROM `+postsWithAuthor+` WHERE p.id IN (SELECT targetid FROM reaction WHERE target = 'post' AND kind = 'like' AND userid=$1) AND p.deleted_at IS NULL AND p.status = 'published'
+		ORDER BY p.created_at DESC, p.id DESC;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get liked posts: %w", err)
+	}
 	return posts, nil
 }
 
+// GetPostByID returns deleted posts too, with Deleted set.
 func (p *PostStorage) GetPostByID(id int) (models.Post, error) {
-	query := `SELECT id, title, content, like, dislike FROM post WHERE id=$1;`
+	query := `SELECT p.id, p.userid, COALESCE(a.username, ''), COALESCE(a.reputation, 0), p.title, p.content, p.content_html, p.like, p.dislike, ` + commentCount + `, ` + isQuestion + `, ` + acceptedAnswer + `, p.status, p.publish_at,
+		p.created_at, p.updated_at, p.deleted_at, COALESCE(p.deleted_by, 0), COALESCE(u.username, ''), p.delete_reason
+		FROM post p LEFT JOIN user a ON a.id = p.userid LEFT JOIN user u ON u.id = p.deleted_by WHERE p.id=$1;`
 	row := p.db.QueryRow(query, id)
-	var post models.Post
-	err := row.Scan(&post.Id, &post.Title, &post.Content, &post.Like, &post.DisLike)
+	var (
+		post        models.Post
+		contentHTML string
+		deletion    models.Deletion
+		publishAt   sql.NullTime
+		createdAt   sql.NullTime
+		updatedAt   sql.NullTime
+		deletedAt   sql.NullTime
+	)
+	err := row.Scan(&post.Id, &post.UserID, &post.Author, &post.AuthorReputation, &post.Title, &post.Content, &contentHTML, &post.Like, &post.DisLike, &post.Comments, &post.Question, &post.AcceptedID, &post.Status, &publishAt,
+		&createdAt, &updatedAt, &deletedAt, &deletion.By, &deletion.ByName, &deletion.Reason)
 	if err != nil {
-		return models.Post{}, fmt.Errorf("storage: get user by login: %w", err)
+		return models.Post{}, fmt.Errorf("storage: get post by id: %w", err)
+	}
+	post.ContentHTML = template.HTML(contentHTML)
+	post.PublishAt = publishAt.Time
+	post.CreatedAt, post.UpdatedAt = createdAt.Time, updatedAt.Time
+	if deletedAt.Valid {
+		deletion.At = deletedAt.Time
+		post.Deleted = &deletion
 	}
 
 	return post, nil
@@ -151,119 +249,284 @@ func (s *PostStorage) GetCategoriesByPostID(postId int) ([]string, error) {
 	return category, nil
 }
 
-func (p *PostStorage) UpdatePost(id, like, dislike int, title, content string) error {
-	query, err := p.db.Prepare(`UPDATE post SET title=?, content=?, like=?, dislike=? WHERE id=?;`)
+// UpdatePost gives the post the title and content of the revision and
+// records the revision in the same transaction.
+func (p *PostStorage) UpdatePost(revision *models.PostRevision, contentHTML string) error {
+	tx, err := p.db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("storage: update post: %w", err)
 	}
-	_, err = query.Exec(title, content, like, dislike, id)
-	if err != nil {
-		fmt.Println("update", err)
+	defer tx.Rollback()
+
+	query := `UPDATE post SET title = $1, content = $2, content_html = $3, updated_at = $4 WHERE id = $5;`
+	if _, err := tx.Exec(query, revision.Title, revision.Content, contentHTML, revision.CreatedAt.UTC(), revision.PostID); err != nil {
+		return fmt.Errorf("storage: update post: %w", err)
+	}
+	if err := createRevision(tx, revision); err != nil {
 		return err
 	}
+	return tx.Commit()
+}
 
+func (p *PostStorage) SetPostHTML(id int, contentHTML string) error {
+	query := `UPDATE post SET content_html = $1 WHERE id = $2;`
+	if _, err := p.db.Exec(query, contentHTML, id); err != nil {
+		return fmt.Errorf("storage: set post html: %w", err)
+	}
 	return nil
 }
 
-func (p *PostStorage) DeletePost(id int) error {
-	query := `DELETE FROM post WHERE id=?`
-	_, err := p.db.Exec(query, id)
+// GetDraftPosts returns the drafts and scheduled posts of the user.
+func (p *PostStorage) GetDraftPosts(userID int) ([]models.Post, error) {
+	query := `SELECT p.id, p.userid, COALESCE(u.username, ''), p.title, p.about, p.status, p.publish_at, p.created_at, p.updated_at
+		FROM ` + postsWithAuthor + `
+		WHERE p.userid = $1 AND p.status != 'published' AND p.deleted_at IS NULL
+		ORDER BY p.status, p.publish_at, p.id DESC;`
+	rows, err := p.db.Query(query, userID)
 	if err != nil {
-		fmt.Println("delete", err)
-		return err
+		return nil, fmt.Errorf("storage: get draft posts: %w", err)
 	}
-	return nil
-}
+	defer rows.Close()
 
-func (p *PostStorage) LikePost(username string, postid int) error {
-	query := `INSERT INTO like (username, postid) values ($1, $2)`
+	var posts []models.Post
+	for rows.Next() {
+		var (
+			post                            models.Post
+			publishAt, createdAt, updatedAt sql.NullTime
+		)
+		if err := rows.Scan(&post.Id, &post.UserID, &post.Author, &post.Title, &post.About, &post.Status, &publishAt, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("storage: get draft posts: %w", err)
+		}
+		post.PublishAt = publishAt.Time
+		post.CreatedAt, post.UpdatedAt = createdAt.Time, updatedAt.Time
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
 
-	_, err := p.db.Exec(query, username, postid)
+// SetPostStatus changes the status of the post. For scheduled posts
+// publishAt is when they go out; for published ones it is the time they
+// were published, which becomes their creation time.
+func (p *PostStorage) SetPostStatus(id int, status string, publishAt time.Time) error {
+	tx, err := p.db.Begin()
 	if err != nil {
-		return fmt.Errorf("repository: like post: Insert query - %w", err)
+		return fmt.Errorf("storage: set post status: %w", err)
 	}
+	defer tx.Rollback()
 
-	query = `UPDATE post SET like = like + 1 WHERE id = $1;`
+	query := `UPDATE post SET status = $1, publish_at = $2 WHERE id = $3;`
+	args := []interface{}{status, nullTime(publishAt), id}
+	if status == models.PostPublished {
+		query = `UPDATE post SET status = $1, publish_at = NULL, created_at = $2, updated_at = $2 WHERE id = $3;`
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return fmt.Errorf("storage: set post status: %w", err)
+	}
+	if err := recountReputation(tx, postEarners, id); err != nil {
+		return fmt.Errorf("storage: set post status: %w", err)
+	}
+	return tx.Commit()
+}
 
-	_, err = p.db.Exec(query, postid)
+// PublishDuePosts publishes the scheduled posts whose time has come and
+// returns their ids. They are dated by their publishing time.
+func (p *PostStorage) PublishDuePosts(now time.Time) ([]int, error) {
+	tx, err := p.db.Begin()
 	if err != nil {
-		return fmt.Errorf("repository: like post: Insert query - %w", err)
+		return nil, fmt.Errorf("storage: publish due posts: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
+	query := `UPDATE post SET status = 'published', created_at = publish_at, updated_at = publish_at
+		WHERE status = 'scheduled' AND publish_at <= $1 RETURNING id;`
+	rows, err := tx.Query(query, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("storage: publish due posts: %w", err)
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("storage: publish due posts: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("storage: publish due posts: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := recountReputation(tx, postEarners, id); err != nil {
+			return nil, fmt.Errorf("storage: publish due posts: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("storage: publish due posts: %w", err)
+	}
+	return ids, nil
 }
 
-func (p *PostStorage) DisLikePost(username string, postid int) error {
-	query := `INSERT INTO dislike (username, postid) values ($1, $2)`
+// SetAcceptedAnswer marks the comment as the accepted answer to the post.
+// A zero commentID clears the accepted answer.
+func (p *PostStorage) SetAcceptedAnswer(postID, commentID int) error {
+	query := `UPDATE post SET accepted_commentid = $1 WHERE id = $2;`
+	if _, err := p.db.Exec(query, nullInt(commentID), postID); err != nil {
+		return fmt.Errorf("storage: set accepted answer: %w", err)
+	}
+	return nil
+}
 
-	_, err := p.db.Exec(query, username, postid)
-	if err != nil {
-		return fmt.Errorf("repository: dislike post: Insert query - %w", err)
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
 	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
 
-	query = `UPDATE post SET dislike = dislike + 1 WHERE id = $1;`
+// nullInt stores the id 0 as NULL.
+func nullInt(id int) sql.NullInt64 {
+	if id == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(id), Valid: true}
+}
 
-	_, err = p.db.Exec(query, postid)
+// DeletePost moves the post to the trash. The points its author earned on
+// it stop counting until it is restored.
+func (p *PostStorage) DeletePost(id, userID int, reason string, at time.Time) error {
+	tx, err := p.db.Begin()
 	if err != nil {
-		return fmt.Errorf("repository: dislike post: Insert query - %w", err)
+		return fmt.Errorf("storage: delete post: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE post SET deleted_at = $1, deleted_by = $2, delete_reason = $3 WHERE id = $4 AND deleted_at IS NULL;`
+	if _, err := tx.Exec(query, at.UTC(), userID, reason, id); err != nil {
+		return fmt.Errorf("storage: delete post: %w", err)
 	}
-	return err
+	if err := recountReputation(tx, postEarners, id); err != nil {
+		return fmt.Errorf("storage: delete post: %w", err)
+	}
+	return tx.Commit()
 }
 
-func (p *PostStorage) RemoveLikePost(id int) error {
-	stmt, err := p.db.Prepare(`UPDATE post SET like = like - 1 WHERE id = $1;`)
+func (p *PostStorage) RestorePost(id int) error {
+	tx, err := p.db.Begin()
 	if err != nil {
-		return fmt.Errorf("repository: remove like from post: Delete query - %w", err)
+		return fmt.Errorf("storage: restore post: %w", err)
 	}
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(id)
-	if err != nil {
-		return fmt.Errorf("repository: remove like from post: Delete query - %w", err)
+	query := `UPDATE post SET deleted_at = NULL, deleted_by = NULL, delete_reason = '' WHERE id = $1;`
+	if _, err := tx.Exec(query, id); err != nil {
+		return fmt.Errorf("storage: restore post: %w", err)
 	}
-	return nil
+	if err := recountReputation(tx, postEarners, id); err != nil {
+		return fmt.Errorf("storage: restore post: %w", err)
+	}
+	return tx.Commit()
 }
 
-func (p *PostStorage) RemoveDisLikePost(id int) error {
-	stmt, err := p.db.Prepare(`UPDATE post SET dislike = dislike - 1 WHERE id = $1;`)
+// GetDeletedPosts returns the posts in the trash, most recently deleted
+// first.
+func (p *PostStorage) GetDeletedPosts() ([]models.Post, error) {
+	query := `SELECT p.id, p.userid, COALESCE(a.username, ''), p.title, p.about, p.deleted_at, COALESCE(p.deleted_by, 0), COALESCE(u.username, ''), p.delete_reason
+		FROM post p LEFT JOIN user a ON a.id = p.userid LEFT JOIN user u ON u.id = p.deleted_by
+		WHERE p.deleted_at IS NOT NULL ORDER BY p.deleted_at DESC;`
+	rows, err := p.db.Query(query)
 	if err != nil {
-		return fmt.Errorf("repository: remove dislike from post: Delete query - %w", err)
+		return nil, fmt.Errorf("storage: get deleted posts: %w", err)
 	}
+	defer rows.Close()
 
-	_, err = stmt.Exec(id)
-	if err != nil {
-		return fmt.Errorf("repository: remove dislike from post: Update query - %w", err)
+	var posts []models.Post
+	for rows.Next() {
+		var (
+			post     models.Post
+			deletion models.Deletion
+		)
+		if err := rows.Scan(&post.Id, &post.UserID, &post.Author, &post.Title, &post.About, &deletion.At, &deletion.By, &deletion.ByName, &deletion.Reason); err != nil {
+			return nil, fmt.Errorf("storage: get deleted posts: %w", err)
+		}
+		post.Deleted = &deletion
+		posts = append(posts, post)
 	}
-	return nil
+	return posts, rows.Err()
 }
 
-func (p *PostStorage) HasUserLiked(username string, postid int) error {
-	var u string
-	query := `SELECT username FROM like WHERE postid=? AND username = $2`
+// GetPostsDeletedBefore returns the ids of the posts that went to the
+// trash before t.
+func (p *PostStorage) GetPostsDeletedBefore(t time.Time) ([]int, error) {
+	return queryIDs(p.db, `SELECT id FROM post WHERE deleted_at IS NOT NULL AND deleted_at < $1;`, t.UTC())
+}
 
-	if err := p.db.QueryRow(query, postid, username).Scan(&u); err != nil {
-		return fmt.Errorf("repository: post has like: %w", err)
+// PurgePost removes the post for good, together with its comments, the
+// reactions to both and the reputation earned on them, and its
+// categories, tags, revisions and notifications. Images and attachments
+// are left to their services, which also remove the stored files.
+func (p *PostStorage) PurgePost(id int) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: purge post: %w", err)
 	}
+	defer tx.Rollback()
 
-	query = `DELETE FROM like WHERE postid=? AND username = $2`
-	if _, err := p.db.Exec(query, postid, username); err != nil {
-		return err
+	// Writing first takes the write lock right away, as in ToggleReaction.
+	if err := dropReputation(tx, `(target = 'post' AND targetid = $1) OR (target = 'comment' AND targetid IN (SELECT id FROM comment WHERE postid = $1))`, id); err != nil {
+		return fmt.Errorf("storage: purge post: %w", err)
 	}
 
-	return nil
+	queries := []string{
+		`DELETE FROM reaction WHERE target = 'post' AND targetid = $1;`,
+		`DELETE FROM reaction WHERE target = 'comment' AND targetid IN (SELECT id FROM comment WHERE postid = $1);`,
+		`DELETE FROM comment_revision WHERE commentid IN (SELECT id FROM comment WHERE postid = $1);`,
+		`DELETE FROM comment WHERE postid = $1;`,
+		`DELETE FROM post_category WHERE postID = $1;`,
+		`DELETE FROM post_tag WHERE postid = $1;`,
+		`DELETE FROM post_revision WHERE postid = $1;`,
+		`DELETE FROM notification WHERE postid = $1;`,
+		`DELETE FROM post WHERE id = $1;`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("storage: purge post: %w", err)
+		}
+	}
+	return tx.Commit()
 }
 
-func (p *PostStorage) HasUserDislike(username string, postid int) error {
-	var u string
-	query := `SELECT username FROM dislike WHERE postid=? AND username = $2`
+// GetOrphanedPostIDs returns the ids of posts that are gone while other
+// rows still point at them, as left behind by the hard deletes of earlier
+// versions.
+func (p *PostStorage) GetOrphanedPostIDs() ([]int, error) {
+	query := `SELECT postid FROM comment WHERE postid NOT IN (SELECT id FROM post)
+		UNION SELECT targetid FROM reaction WHERE target = 'post' AND targetid NOT IN (SELECT id FROM post)
+		UNION SELECT postID FROM post_category WHERE postID NOT IN (SELECT id FROM post)
+		UNION SELECT postid FROM post_tag WHERE postid NOT IN (SELECT id FROM post)
+		UNION SELECT postid FROM post_revision WHERE postid NOT IN (SELECT id FROM post)
+		UNION SELECT postid FROM image WHERE postid NOT IN (SELECT id FROM post)
+		UNION SELECT postid FROM attachment WHERE postid NOT IN (SELECT id FROM post);`
+	return queryIDs(p.db, query)
+}
 
-	if err := p.db.QueryRow(query, postid, username).Scan(&u); err != nil {
-		return fmt.Errorf("repository: post has dislike: %w", err)
+func queryIDs(db *sql.DB, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: query ids: %w", err)
 	}
+	defer rows.Close()
 
-	query = `DELETE FROM dislike WHERE postid=? AND username = $2`
-	if _, err := p.db.Exec(query, postid, username); err != nil {
-		return err
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("storage: query ids: %w", err)
+		}
+		ids = append(ids, id)
 	}
-
-	return nil
+	return ids, rows.Err()
 }
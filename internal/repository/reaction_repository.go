@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+	"time"
+)
+
+var errUnknownTarget = errors.New("unknown reaction target")
+
+type Reaction interface {
+	ToggleReaction(userID int, target string, targetID int, kind string) error
+	GetReactions(target string, targetIDs []int) ([]models.Reaction, error)
+	GetUserReactions(userID int, target string, targetIDs []int) ([]models.Reaction, error)
+	GetReactionUsers(target string, targetID int, kind string, limit, offset int) ([]models.Reaction, error)
+	CountReactions(target string, targetID int) (map[string]int, error)
+}
+
+type ReactionStorage struct {
+	db *sql.DB
+}
+
+func NewReactionSqlite(db *sql.DB) *ReactionStorage {
+	return &ReactionStorage{db: db}
+}
+
+// counterQueries recount the like and dislike columns of a target from its
+// reactions.
+var counterQueries = map[string]string{
+	models.TargetPost: `UPDATE post SET
+		like = (SELECT COUNT(*) FROM reaction WHERE target = 'post' AND targetid = post.id AND kind = 'like'),
+		dislike = (SELECT COUNT(*) FROM reaction WHERE target = 'post' AND targetid = post.id AND kind = 'dislike')
+		WHERE id = $1;`,
+	models.TargetComment: `UPDATE comment SET
+		like = (SELECT COUNT(*) FROM reaction WHERE target = 'comment' AND targetid = comment.id AND kind = 'like'),
+		dislike = (SELECT COUNT(*) FROM reaction WHERE target = 'comment' AND targetid = comment.id AND kind = 'dislike')
+		WHERE id = $1;`,
+}
+
+// ToggleReaction removes the reaction of the given kind of the user from
+// the target, or adds it when there is none. A like replaces a dislike of
+// the user and the other way round; the counters of the target are
+// recounted in the same transaction, so they always match the reactions.
+func (s *ReactionStorage) ToggleReaction(userID int, target string, targetID int, kind string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: toggle reaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := toggleReaction(tx, userID, target, targetID, kind); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// toggleReaction does the work of ToggleReaction inside the transaction.
+func toggleReaction(tx *sql.Tx, userID int, target string, targetID int, kind string) error {
+	recount, ok := counterQueries[target]
+	if !ok {
+		return fmt.Errorf("storage: toggle reaction: %w", errUnknownTarget)
+	}
+
+	// Writing first takes the write lock right away; a transaction that
+	// read first could not upgrade its lock while another one writes.
+	result, err := tx.Exec(`DELETE FROM reaction WHERE userid = $1 AND target = $2 AND targetid = $3 AND kind = $4;`, userID, target, targetID, kind)
+	if err != nil {
+		return fmt.Errorf("storage: toggle reaction: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("storage: toggle reaction: %w", err)
+	}
+
+	vote := kind == models.ReactionLike || kind == models.ReactionDislike
+	if removed == 0 {
+		query := `INSERT INTO reaction (userid, target, targetid, kind, created_at) VALUES ($1, $2, $3, $4, $5);`
+		if vote {
+			query = `INSERT INTO reaction (userid, target, targetid, kind, created_at) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (userid, target, targetid) WHERE kind IN ('like', 'dislike') DO UPDATE SET kind = excluded.kind, created_at = excluded.created_at;`
+		}
+		if _, err := tx.Exec(query, userID, target, targetID, kind, time.Now().UTC()); err != nil {
+			return fmt.Errorf("storage: toggle reaction: %w", err)
+		}
+	}
+
+	if vote {
+		if _, err := tx.Exec(recount, targetID); err != nil {
+			return fmt.Errorf("storage: toggle reaction: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetReactions returns the emoji reactions to the targets, leaving out
+// likes and dislikes, in the order they were made.
+func (s *ReactionStorage) GetReactions(target string, targetIDs []int) ([]models.Reaction, error) {
+	if len(targetIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{target}
+	query := `SELECT r.targetid, r.kind, r.userid, COALESCE(u.username, '') FROM reaction r LEFT JOIN user u ON u.id = r.userid
+		WHERE r.target = $1 AND r.targetid IN (` + placeholders(&args, targetIDs) + `) AND r.kind NOT IN ('like', 'dislike')
+		ORDER BY r.id;`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get reactions: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []models.Reaction
+	for rows.Next() {
+		reaction := models.Reaction{Target: target}
+		if err := rows.Scan(&reaction.TargetID, &reaction.Kind, &reaction.UserID, &reaction.Username); err != nil {
+			return nil, fmt.Errorf("storage: get reactions: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions, rows.Err()
+}
+
+// GetUserReactions returns all reactions of the user to the targets,
+// likes and dislikes included.
+func (s *ReactionStorage) GetUserReactions(userID int, target string, targetIDs []int) ([]models.Reaction, error) {
+	if len(targetIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{userID, target}
+	query := `SELECT targetid, kind FROM reaction WHERE userid = $1 AND target = $2 AND targetid IN (` + placeholders(&args, targetIDs) + `) ORDER BY id;`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get user reactions: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []models.Reaction
+	for rows.Next() {
+		reaction := models.Reaction{Target: target, UserID: userID}
+		if err := rows.Scan(&reaction.TargetID, &reaction.Kind); err != nil {
+			return nil, fmt.Errorf("storage: get user reactions: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions, rows.Err()
+}
+
+// GetReactionUsers returns the reactions of one kind to the target with
+// the users who made them, newest first.
+func (s *ReactionStorage) GetReactionUsers(target string, targetID int, kind string, limit, offset int) ([]models.Reaction, error) {
+	query := `SELECT r.userid, COALESCE(u.username, ''), r.created_at FROM reaction r LEFT JOIN user u ON u.id = r.userid
+		WHERE r.target = $1 AND r.targetid = $2 AND r.kind = $3
+		ORDER BY r.created_at DESC, r.id DESC LIMIT $4 OFFSET $5;`
+	rows, err := s.db.Query(query, target, targetID, kind, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get reaction users: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []models.Reaction
+	for rows.Next() {
+		var createdAt sql.NullTime
+		reaction := models.Reaction{Target: target, TargetID: targetID, Kind: kind}
+		if err := rows.Scan(&reaction.UserID, &reaction.Username, &createdAt); err != nil {
+			return nil, fmt.Errorf("storage: get reaction users: %w", err)
+		}
+		reaction.CreatedAt = createdAt.Time
+		reactions = append(reactions, reaction)
+	}
+	return reactions, rows.Err()
+}
+
+// CountReactions counts the reactions to the target by kind.
+func (s *ReactionStorage) CountReactions(target string, targetID int) (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT kind, COUNT(*) FROM reaction WHERE target = $1 AND targetid = $2 GROUP BY kind;`, target, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: count reactions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			kind  string
+			count int
+		)
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, fmt.Errorf("storage: count reactions: %w", err)
+		}
+		counts[kind] = count
+	}
+	return counts, rows.Err()
+}
+
+// placeholders appends the ids to the query arguments and returns the
+// list of their placeholders for an IN clause.
+func placeholders(args *[]interface{}, ids []int) string {
+	marks := make([]string, len(ids))
+	for i, id := range ids {
+		*args = append(*args, id)
+		marks[i] = fmt.Sprintf("$%d", len(*args))
+	}
+	return strings.Join(marks, ", ")
+}
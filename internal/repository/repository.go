@@ -8,12 +8,34 @@ type Repository struct {
 	Authorization
 	PostItem
 	Comment
+	Category
+	Permission
+	Tag
+	Image
+	Attachment
+	Revision
+	Notification
+	Reaction
+	Reputation
+	Badge
+	Blobs BlobStore
 }
 
-func NewRepository(db *sql.DB) *Repository {
+func NewRepository(db *sql.DB, blobs BlobStore) *Repository {
 	return &Repository{
 		Authorization: NewAuthSqlite(db),
 		PostItem:      NewPostSqlite(db),
 		Comment:       NewCommentSqlite(db),
+		Category:      NewCategorySqlite(db),
+		Permission:    NewPermissionSqlite(db),
+		Tag:           NewTagSqlite(db),
+		Image:         NewImageSqlite(db),
+		Attachment:    NewAttachmentSqlite(db),
+		Revision:      NewRevisionSqlite(db),
+		Notification:  NewNotificationSqlite(db),
+		Reaction:      NewReactionSqlite(db),
+		Reputation:    NewReputationSqlite(db),
+		Badge:         NewBadgeSqlite(db),
+		Blobs:         blobs,
 	}
 }
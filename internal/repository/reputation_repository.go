@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+type Reputation interface {
+	ToggleVote(event models.ReputationEvent, points map[string]int, dailyCap int) error
+	ScoreVote(event models.ReputationEvent, dailyCap int) error
+	GetUnscoredVotes() ([]models.ReputationEvent, error)
+	RecountReputation() error
+	GetReputation(userID int) (int, error)
+}
+
+type ReputationStorage struct {
+	db *sql.DB
+}
+
+func NewReputationSqlite(db *sql.DB) *ReputationStorage {
+	return &ReputationStorage{db: db}
+}
+
+// ToggleVote toggles the like or dislike of the event's actor on the
+// target, as ToggleReaction does, and scores the vote the actor is left
+// with in the same transaction. The author gets the points of that vote
+// from points; a UserID of 0 scores nothing.
+func (s *ReputationStorage) ToggleVote(event models.ReputationEvent, points map[string]int, dailyCap int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: toggle vote: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := toggleReaction(tx, event.ActorID, event.Target, event.TargetID, event.Kind); err != nil {
+		return err
+	}
+
+	var kind string
+	err = tx.QueryRow(`SELECT kind FROM reaction WHERE userid = $1 AND target = $2 AND targetid = $3 AND kind IN ('like', 'dislike');`,
+		event.ActorID, event.Target, event.TargetID).Scan(&kind)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		event.UserID = 0
+	case err != nil:
+		return fmt.Errorf("storage: toggle vote: %w", err)
+	default:
+		event.Kind, event.Points = kind, points[kind]
+	}
+
+	if err := scoreVote(tx, event, dailyCap); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ScoreVote takes back the points the earlier vote of the actor on the
+// target earned and, unless UserID is 0 because the vote was taken back,
+// records the event and adds its points to the reputation of the user.
+// Gains are cut down so the user gains at most dailyCap points on the day
+// of the event; a dailyCap of 0 does not limit them.
+func (s *ReputationStorage) ScoreVote(event models.ReputationEvent, dailyCap int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: score vote: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := scoreVote(tx, event, dailyCap); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scoreVote does the work of ScoreVote inside the transaction.
+func scoreVote(tx *sql.Tx, event models.ReputationEvent, dailyCap int) error {
+	// Writing first takes the write lock right away, as in ToggleReaction.
+	rows, err := tx.Query(`DELETE FROM reputation WHERE actorid = $1 AND target = $2 AND targetid = $3 RETURNING userid;`,
+		event.ActorID, event.Target, event.TargetID)
+	if err != nil {
+		return fmt.Errorf("storage: score vote: %w", err)
+	}
+	taken := make(map[int]bool)
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("storage: score vote: %w", err)
+		}
+		taken[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("storage: score vote: %w", err)
+	}
+
+	for userID := range taken {
+		if err := recountReputation(tx, `$1`, userID); err != nil {
+			return fmt.Errorf("storage: score vote: %w", err)
+		}
+	}
+
+	if event.UserID == 0 {
+		return nil
+	}
+
+	points := event.Points
+	if points > 0 && dailyCap > 0 {
+		day := event.CreatedAt.UTC().Truncate(24 * time.Hour)
+		var gained int
+		err := tx.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM reputation WHERE userid = $1 AND points > 0 AND created_at >= $2 AND created_at < $3;`,
+			event.UserID, day, day.Add(24*time.Hour)).Scan(&gained)
+		if err != nil {
+			return fmt.Errorf("storage: score vote: %w", err)
+		}
+		if points > dailyCap-gained {
+			points = dailyCap - gained
+		}
+		if points < 0 {
+			points = 0
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO reputation (userid, actorid, target, targetid, kind, points, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		event.UserID, event.ActorID, event.Target, event.TargetID, event.Kind, points, event.CreatedAt.UTC()); err != nil {
+		return fmt.Errorf("storage: score vote: %w", err)
+	}
+	if err := recountReputation(tx, `$1`, event.UserID); err != nil {
+		return fmt.Errorf("storage: score vote: %w", err)
+	}
+	return nil
+}
+
+// countedPoints sums the points that count toward the reputation of the
+// user. Like the likes and dislikes reputation was once summed from,
+// points earned on posts that are in the trash or not published, and on
+// comments in the trash, do not count until the post or comment is back.
+const countedPoints = `(SELECT COALESCE(SUM(r.points), 0) FROM reputation r WHERE r.userid = user.id AND CASE r.target
+	WHEN 'post' THEN EXISTS (SELECT 1 FROM post WHERE id = r.targetid AND deleted_at IS NULL AND status = 'published')
+	ELSE EXISTS (SELECT 1 FROM comment WHERE id = r.targetid AND deleted_at IS NULL) END)`
+
+// Queries selecting the users who earned points on post or comment $1,
+// for recountReputation.
+const (
+	postEarners    = `SELECT userid FROM reputation WHERE target = 'post' AND targetid = $1`
+	commentEarners = `SELECT userid FROM reputation WHERE target = 'comment' AND targetid = $1`
+)
+
+// recountReputation sets the reputation of the users the query selects to
+// their counted points. It is run whenever points are scored or taken
+// back and whenever a post or comment they were earned on goes to the
+// trash, comes back or changes its status.
+func recountReputation(tx *sql.Tx, users string, args ...interface{}) error {
+	_, err := tx.Exec(`UPDATE user SET reputation = `+countedPoints+` WHERE id IN (`+users+`);`, args...)
+	return err
+}
+
+// dropReputation deletes the points earned on the posts and comments the
+// condition selects, for good, and recounts the reputation of the users
+// who earned them.
+func dropReputation(tx *sql.Tx, condition string, args ...interface{}) error {
+	rows, err := tx.Query(`DELETE FROM reputation WHERE `+condition+` RETURNING userid;`, args...)
+	if err != nil {
+		return err
+	}
+	users := make(map[int]bool)
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		users[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for userID := range users {
+		if err := recountReputation(tx, `$1`, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUnscoredVotes returns the likes and dislikes of posts and comments
+// that have no reputation recorded yet, oldest first, with the author as
+// UserID. Votes on posts and comments without an author are left out.
+func (s *ReputationStorage) GetUnscoredVotes() ([]models.ReputationEvent, error) {
+	query := `SELECT actorid, target, targetid, kind, created_at, author FROM (
+			SELECT r.id, r.userid AS actorid, r.target, r.targetid, r.kind, r.created_at, CASE r.target
+				WHEN 'post' THEN (SELECT userid FROM post WHERE id = r.targetid)
+				ELSE (SELECT userid FROM comment WHERE id = r.targetid) END AS author
+			FROM reaction r
+			WHERE r.kind IN ('like', 'dislike')
+			AND NOT EXISTS (SELECT 1 FROM reputation p WHERE p.actorid = r.userid AND p.target = r.target AND p.targetid = r.targetid)
+		) WHERE author IN (SELECT id FROM user)
+		ORDER BY created_at, id;`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get unscored votes: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.ReputationEvent
+	for rows.Next() {
+		var (
+			event     models.ReputationEvent
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&event.ActorID, &event.Target, &event.TargetID, &event.Kind, &createdAt, &event.UserID); err != nil {
+			return nil, fmt.Errorf("storage: get unscored votes: %w", err)
+		}
+		event.CreatedAt = createdAt.Time
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// RecountReputation sets the reputation of every user to their counted
+// points.
+func (s *ReputationStorage) RecountReputation() error {
+	if _, err := s.db.Exec(`UPDATE user SET reputation = ` + countedPoints + `;`); err != nil {
+		return fmt.Errorf("storage: recount reputation: %w", err)
+	}
+	return nil
+}
+
+// GetReputation returns the reputation of the user.
+func (s *ReputationStorage) GetReputation(userID int) (int, error) {
+	var reputation int
+	if err := s.db.QueryRow(`SELECT COALESCE(reputation, 0) FROM user WHERE id = $1;`, userID).Scan(&reputation); err != nil {
+		return 0, fmt.Errorf("storage: get reputation: %w", err)
+	}
+	return reputation, nil
+}
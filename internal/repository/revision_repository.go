@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+	"time"
+)
+
+type Revision interface {
+	GetRevisionsByPostID(postID int) ([]models.PostRevision, error)
+	GetRevisionsByCommentID(commentID int) ([]models.CommentRevision, error)
+}
+
+type RevisionStorage struct {
+	db *sql.DB
+}
+
+func NewRevisionSqlite(db *sql.DB) *RevisionStorage {
+	return &RevisionStorage{db: db}
+}
+
+// createRevision records the revision inside the transaction that
+// creates or changes the post.
+func createRevision(tx *sql.Tx, revision *models.PostRevision) error {
+	query := `INSERT INTO post_revision (postid, editorid, createdat, title, content, reason) VALUES ($1, $2, $3, $4, $5, $6);`
+	result, err := tx.Exec(query, revision.PostID, revision.EditorID, revision.CreatedAt.UTC(), revision.Title, revision.Content, revision.Reason)
+	if err != nil {
+		return fmt.Errorf("storage: create revision: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("storage: create revision: %w", err)
+	}
+	revision.ID = int(id)
+	return nil
+}
+
+// GetRevisionsByPostID returns the revisions oldest first, numbered from 1.
+func (s *RevisionStorage) GetRevisionsByPostID(postID int) ([]models.PostRevision, error) {
+	query := `SELECT r.id, r.postid, r.editorid, COALESCE(u.username, ''), r.createdat, r.title, r.content, r.reason
+		FROM post_revision r LEFT JOIN user u ON u.id = r.editorid
+		WHERE r.postid = $1 ORDER BY r.id;`
+	rows, err := s.db.Query(query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get revisions by post id: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.PostRevision
+	for rows.Next() {
+		var (
+			r         models.PostRevision
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&r.ID, &r.PostID, &r.EditorID, &r.Editor, &createdAt, &r.Title, &r.Content, &r.Reason); err != nil {
+			return nil, fmt.Errorf("storage: get revisions by post id: %w", err)
+		}
+		if createdAt.Valid {
+			r.CreatedAt = createdAt.Time.In(time.UTC)
+		}
+		r.Number = len(revisions) + 1
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// createCommentRevision records the revision inside the transaction that
+// changes the comment. A comment edited for the first time gets the text
+// it was written with recorded first.
+func createCommentRevision(tx *sql.Tx, revision *models.CommentRevision) error {
+	query := `INSERT INTO comment_revision (commentid, editorid, created_at, text, reason)
+		SELECT id, userid, created_at, text, '' FROM comment
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM comment_revision WHERE commentid = $1);`
+	if _, err := tx.Exec(query, revision.CommentID); err != nil {
+		return fmt.Errorf("storage: create comment revision: %w", err)
+	}
+
+	query = `INSERT INTO comment_revision (commentid, editorid, created_at, text, reason) VALUES ($1, $2, $3, $4, $5);`
+	result, err := tx.Exec(query, revision.CommentID, revision.EditorID, nullTime(revision.CreatedAt), revision.Text, revision.Reason)
+	if err != nil {
+		return fmt.Errorf("storage: create comment revision: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("storage: create comment revision: %w", err)
+	}
+	revision.ID = int(id)
+	return nil
+}
+
+// GetRevisionsByCommentID returns the revisions oldest first, numbered
+// from 1.
+func (s *RevisionStorage) GetRevisionsByCommentID(commentID int) ([]models.CommentRevision, error) {
+	query := `SELECT r.id, r.commentid, r.editorid, COALESCE(u.username, ''), r.created_at, r.text, r.reason
+		FROM comment_revision r LEFT JOIN user u ON u.id = r.editorid
+		WHERE r.commentid = $1 ORDER BY r.id;`
+	rows, err := s.db.Query(query, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get revisions by comment id: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.CommentRevision
+	for rows.Next() {
+		var (
+			r         models.CommentRevision
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&r.ID, &r.CommentID, &r.EditorID, &r.Editor, &createdAt, &r.Text, &r.Reason); err != nil {
+			return nil, fmt.Errorf("storage: get revisions by comment id: %w", err)
+		}
+		if createdAt.Valid {
+			r.CreatedAt = createdAt.Time.In(time.UTC)
+		}
+		r.Number = len(revisions) + 1
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"forum/internal/models"
+	"strings"
+)
+
+type Tag interface {
+	GetTagByName(name string) (models.Tag, error)
+	GetTagByID(id int) (models.Tag, error)
+	GetSynonyms(tagID int) ([]string, error)
+	GetTagsByPostID(postID int) ([]string, error)
+	SearchTags(prefix string, hidden []string, limit int) ([]models.Tag, error)
+	GetPopularTags(hidden []string, limit int) ([]models.Tag, error)
+	MergeTags(fromID, toID int) error
+}
+
+type TagStorage struct {
+	db *sql.DB
+}
+
+func NewTagSqlite(db *sql.DB) *TagStorage {
+	return &TagStorage{db: db}
+}
+
+func (s *TagStorage) GetTagByName(name string) (models.Tag, error) {
+	var t models.Tag
+	query := `SELECT id, name, COALESCE(synonymof, 0), (SELECT COUNT(*) FROM post_tag pt JOIN post p ON p.id = pt.postid WHERE pt.tagid = tag.id AND p.deleted_at IS NULL AND p.status = 'published') FROM tag WHERE name = $1;`
+	if err := s.db.QueryRow(query, name).Scan(&t.ID, &t.Name, &t.SynonymOf, &t.Count); err != nil {
+		return models.Tag{}, fmt.Errorf("storage: get tag by name: %w", err)
+	}
+	return t, nil
+}
+
+func (s *TagStorage) GetTagByID(id int) (models.Tag, error) {
+	var t models.Tag
+	query := `SELECT id, name, COALESCE(synonymof, 0), (SELECT COUNT(*) FROM post_tag pt JOIN post p ON p.id = pt.postid WHERE pt.tagid = tag.id AND p.deleted_at IS NULL AND p.status = 'published') FROM tag WHERE id = $1;`
+	if err := s.db.QueryRow(query, id).Scan(&t.ID, &t.Name, &t.SynonymOf, &t.Count); err != nil {
+		return models.Tag{}, fmt.Errorf("storage: get tag by id: %w", err)
+	}
+	return t, nil
+}
+
+func (s *TagStorage) GetSynonyms(tagID int) ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM tag WHERE synonymof = $1 ORDER BY name;`, tagID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get synonyms: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("storage: get synonyms: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s *TagStorage) GetTagsByPostID(postID int) ([]string, error) {
+	query := `SELECT t.name FROM post_tag pt JOIN tag t ON t.id = pt.tagid WHERE pt.postid = $1 ORDER BY t.name;`
+	rows, err := s.db.Query(query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: get tags by post id: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("storage: get tags by post id: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// SearchTags matches the prefix against tag names and synonyms and returns
+// the canonical tags, most used first. Posts filed under any of the hidden
+// categories are not counted, and tags left without posts are skipped.
+func (s *TagStorage) SearchTags(prefix string, hidden []string, limit int) ([]models.Tag, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	filter, filterArgs := excludeCategories("p.id", hidden)
+	query := `SELECT id, name, uses FROM (
+		SELECT DISTINCT c.id, c.name, (SELECT COUNT(*) FROM post_tag pt JOIN post p ON p.id = pt.postid WHERE pt.tagid = c.id AND p.deleted_at IS NULL AND p.status = 'published'` + filter + `) AS uses
+		FROM tag t JOIN tag c ON c.id = COALESCE(t.synonymof, t.id)
+		WHERE t.name LIKE ? ESCAPE '\'
+	)
+	WHERE uses > 0
+	ORDER BY uses DESC, name
+	LIMIT ?;`
+
+	args := append(filterArgs, escaped+"%", limit)
+	return s.queryTags(query, args...)
+}
+
+// GetPopularTags returns the most used tags. Posts filed under any of the
+// hidden categories are not counted.
+func (s *TagStorage) GetPopularTags(hidden []string, limit int) ([]models.Tag, error) {
+	filter, filterArgs := excludeCategories("p.id", hidden)
+	query := `SELECT t.id, t.name, COUNT(pt.postid) AS uses
+	FROM tag t JOIN post_tag pt ON pt.tagid = t.id JOIN post p ON p.id = pt.postid
+	WHERE t.synonymof IS NULL AND p.deleted_at IS NULL AND p.status = 'published'` + filter + `
+	GROUP BY t.id
+	ORDER BY uses DESC, t.name
+	LIMIT ?;`
+
+	args := append(filterArgs, limit)
+	return s.queryTags(query, args...)
+}
+
+func (s *TagStorage) queryTags(query string, args ...interface{}) ([]models.Tag, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage: query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Count); err != nil {
+			return nil, fmt.Errorf("storage: query tags: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// MergeTags moves every post from one tag to another and turns the source
+// tag, along with its own synonyms, into a synonym of the target.
+func (s *TagStorage) MergeTags(fromID, toID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("storage: merge tags: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO post_tag (postid, tagid) SELECT postid, ? FROM post_tag WHERE tagid = ?;`, toID, fromID); err != nil {
+		return fmt.Errorf("storage: merge tags: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM post_tag WHERE tagid = ?;`, fromID); err != nil {
+		return fmt.Errorf("storage: merge tags: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE tag SET synonymof = ? WHERE id = ? OR synonymof = ?;`, toID, fromID, fromID); err != nil {
+		return fmt.Errorf("storage: merge tags: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAttachment  = errors.New("invalid attachment")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+)
+
+const (
+	MaxAttachmentSize = 10 << 20
+	MaxAttachments    = 5
+	maxAttachmentName = 100
+	attachmentPrefix  = "attachments/"
+)
+
+type Attachment interface {
+	PrepareAttachments(userID int, files []AttachmentFile) ([]*AttachmentUpload, error)
+	NewFiles(userID int, images []*ImageUpload, uploads []*AttachmentUpload) (repository.Files, error)
+	GetPostAttachments(postID int) ([]models.Attachment, error)
+	GetCommentAttachments(postID int) (map[int][]models.Attachment, error)
+	GetAttachment(id int) (models.Attachment, error)
+	DownloadURL(attachment models.Attachment) (string, error)
+	DeletePostAttachments(postID int) error
+	DeleteCommentAttachments(commentID int) error
+	GetStorageUsage(userID int) (models.StorageUsage, error)
+	GetDefaultQuota() int64
+	GetUserQuotas() ([]models.UserQuota, error)
+	SetUserQuota(username string, megabytes int64) error
+	ResetUserQuota(userID int) error
+	GetAllowedTypes() ([]string, error)
+	AllowType(mimeType string) error
+	DisallowType(mimeType string) error
+}
+
+// AttachmentFile is a file as received from the client.
+type AttachmentFile struct {
+	Name string
+	Data []byte
+}
+
+// AttachmentUpload is a checked attachment waiting for its post or comment.
+type AttachmentUpload struct {
+	models.Attachment
+	data []byte
+}
+
+type AttachmentService struct {
+	repo   repository.Attachment
+	users  repository.Authorization
+	store  repository.BlobStore
+	expiry time.Duration
+	quota  int64
+}
+
+func NewAttachmentService(repo repository.Attachment, users repository.Authorization, store repository.BlobStore, expiry time.Duration, quota int64) *AttachmentService {
+	return &AttachmentService{repo: repo, users: users, store: store, expiry: expiry, quota: quota}
+}
+
+// PrepareAttachments checks the type and size of every file and the quota
+// of the user before anything is stored.
+func (a *AttachmentService) PrepareAttachments(userID int, files []AttachmentFile) ([]*AttachmentUpload, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if len(files) > MaxAttachments {
+		return nil, fmt.Errorf("service: prepare attachments: %w: at most %d files", ErrInvalidAttachment, MaxAttachments)
+	}
+
+	allowed, err := a.allowedTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := a.GetStorageUsage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]*AttachmentUpload, 0, len(files))
+	for _, file := range files {
+		if len(file.Data) > MaxAttachmentSize {
+			return nil, fmt.Errorf("service: prepare attachments: %w: %s is larger than %s", ErrInvalidAttachment, file.Name, models.HumanBytes(MaxAttachmentSize))
+		}
+
+		contentType := detectType(file.Name, file.Data)
+		if !allowed[contentType] {
+			return nil, fmt.Errorf("service: prepare attachments: %w: files of type %s are not allowed", ErrInvalidAttachment, contentType)
+		}
+
+		usage.Used += int64(len(file.Data))
+		if usage.Used > usage.Limit {
+			return nil, fmt.Errorf("service: prepare attachments: %w: %s allowed", ErrQuotaExceeded, models.HumanBytes(usage.Limit))
+		}
+
+		sum := sha256.Sum256(file.Data)
+		uploads = append(uploads, &AttachmentUpload{
+			Attachment: models.Attachment{
+				UserID:      userID,
+				Name:        cleanFileName(file.Name),
+				Key:         attachmentPrefix + hex.EncodeToString(sum[:]),
+				ContentType: contentType,
+				Size:        int64(len(file.Data)),
+			},
+			data: file.Data,
+		})
+	}
+	return uploads, nil
+}
+
+// NewFiles gathers the images and attachments of a new post or comment
+// of the user for the repository, which writes them in the transaction
+// creating it. Their blobs are put from inside that transaction, and the
+// quota is checked there again, as other uploads of the user may have got
+// in since PrepareAttachments. Images share the blob store, so they come
+// along.
+func (a *AttachmentService) NewFiles(userID int, images []*ImageUpload, uploads []*AttachmentUpload) (repository.Files, error) {
+	var (
+		files repository.Files
+		blobs []pendingBlob
+	)
+	for _, upload := range images {
+		files.Images = append(files.Images, &upload.Image)
+		blobs = append(blobs, pendingBlob{key: upload.Filename, contentType: upload.ContentType, data: upload.data})
+	}
+	for _, upload := range uploads {
+		files.Attachments = append(files.Attachments, &upload.Attachment)
+		blobs = append(blobs, pendingBlob{key: upload.Key, contentType: upload.ContentType, data: upload.data})
+	}
+	if len(blobs) == 0 {
+		return files, nil
+	}
+
+	if len(uploads) > 0 {
+		usage, err := a.GetStorageUsage(userID)
+		if err != nil {
+			return repository.Files{}, err
+		}
+		files.Quota = usage.Limit
+	}
+	files.Put = func() error {
+		return putNew(a.store, blobs)
+	}
+	return files, nil
+}
+
+// quotaError turns the ErrQuotaExceeded of the repository into the one of
+// the service, with the quota the files were checked against.
+func quotaError(err error, files repository.Files) error {
+	if errors.Is(err, repository.ErrQuotaExceeded) {
+		return fmt.Errorf("service: save attachments: %w: %s allowed", ErrQuotaExceeded, models.HumanBytes(files.Quota))
+	}
+	return err
+}
+
+// GetPostAttachments returns the files attached to the post itself.
+func (a *AttachmentService) GetPostAttachments(postID int) ([]models.Attachment, error) {
+	all, err := a.repo.GetAttachmentsByPostID(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []models.Attachment
+	for _, attachment := range all {
+		if attachment.CommentID == 0 {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+// GetCommentAttachments returns the files of all comments of a post keyed
+// by comment id.
+func (a *AttachmentService) GetCommentAttachments(postID int) (map[int][]models.Attachment, error) {
+	all, err := a.repo.GetAttachmentsByPostID(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make(map[int][]models.Attachment)
+	for _, attachment := range all {
+		if attachment.CommentID != 0 {
+			attachments[attachment.CommentID] = append(attachments[attachment.CommentID], attachment)
+		}
+	}
+	return attachments, nil
+}
+
+func (a *AttachmentService) GetAttachment(id int) (models.Attachment, error) {
+	attachment, err := a.repo.GetAttachmentByID(id)
+	if err != nil {
+		return models.Attachment{}, fmt.Errorf("service: get attachment: %w: %v", ErrAttachmentNotFound, err)
+	}
+	return attachment, nil
+}
+
+// DownloadURL counts the download and returns a signed link to the file.
+func (a *AttachmentService) DownloadURL(attachment models.Attachment) (string, error) {
+	if err := a.repo.IncrementDownloads(attachment.ID); err != nil {
+		return "", err
+	}
+	return a.store.URL(attachment.Key, a.expiry, attachment.Name)
+}
+
+// DeletePostAttachments removes the files of a post and its comments.
+// Blobs are removed once no other attachment shares them.
+func (a *AttachmentService) DeletePostAttachments(postID int) error {
+	return a.repo.DeleteAttachmentsByPostID(postID, a.deleteBlob)
+}
+
+func (a *AttachmentService) DeleteCommentAttachments(commentID int) error {
+	return a.repo.DeleteAttachmentsByCommentID(commentID, a.deleteBlob)
+}
+
+func (a *AttachmentService) deleteBlob(key string) error {
+	if err := a.store.Delete(key); err != nil {
+		return fmt.Errorf("service: delete attachments: %w", err)
+	}
+	return nil
+}
+
+func (a *AttachmentService) GetStorageUsage(userID int) (models.StorageUsage, error) {
+	used, err := a.repo.GetUsedStorage(userID)
+	if err != nil {
+		return models.StorageUsage{}, err
+	}
+
+	limit, err := a.repo.GetUserQuota(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		limit = a.quota
+	} else if err != nil {
+		return models.StorageUsage{}, err
+	}
+
+	return models.StorageUsage{Used: used, Limit: limit}, nil
+}
+
+func (a *AttachmentService) GetDefaultQuota() int64 {
+	return a.quota
+}
+
+func (a *AttachmentService) GetUserQuotas() ([]models.UserQuota, error) {
+	return a.repo.GetUserQuotas()
+}
+
+func (a *AttachmentService) SetUserQuota(username string, megabytes int64) error {
+	if megabytes < 0 {
+		return fmt.Errorf("service: set user quota: %w: quota must not be negative", ErrInvalidAttachment)
+	}
+
+	user, err := a.users.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("service: set user quota: %w", ErrUserNotFound)
+	}
+	return a.repo.SetUserQuota(user.ID, megabytes<<20)
+}
+
+func (a *AttachmentService) ResetUserQuota(userID int) error {
+	return a.repo.DeleteUserQuota(userID)
+}
+
+func (a *AttachmentService) GetAllowedTypes() ([]string, error) {
+	return a.repo.GetAllowedTypes()
+}
+
+func (a *AttachmentService) AllowType(mimeType string) error {
+	mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mimeType))
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return fmt.Errorf("service: allow type: %w: %q is not a MIME type", ErrInvalidAttachment, mimeType)
+	}
+	return a.repo.AddAllowedType(mediaType)
+}
+
+func (a *AttachmentService) DisallowType(mimeType string) error {
+	return a.repo.DeleteAllowedType(mimeType)
+}
+
+func (a *AttachmentService) allowedTypes() (map[string]bool, error) {
+	types, err := a.repo.GetAllowedTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[t] = true
+	}
+	return allowed, nil
+}
+
+// detectType sniffs the content type of a file. The extension is only
+// consulted for formats the sniffer does not know, such as 7z or tar.
+func detectType(name string, data []byte) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	if byExtension, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name))); err == nil {
+		return byExtension
+	}
+	return contentType
+}
+
+// cleanFileName keeps the base name of an uploaded file, without path or
+// control characters, and shortens it to a sane length.
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || r == 127 || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+
+	name = strings.ToValidUTF8(name, "")
+	if len(name) > maxAttachmentName {
+		name = strings.ToValidUTF8(name[:maxAttachmentName], "")
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
@@ -19,6 +19,7 @@ var (
 	ErrInvalidPassword = errors.New("invalid password")
 	ErrUserNotFound    = errors.New("user not found")
 	ErrUserExist       = errors.New("user exist")
+	ErrInvalidTimezone = errors.New("invalid timezone")
 )
 
 type Authorization interface {
@@ -27,14 +28,17 @@ type Authorization interface {
 	GetSessionToken(token string) (models.User, error)
 	GetSessionTokenFromRequest(r *http.Request) models.User
 	DeleteSessionToken(token string) error
+	SetTimezone(userID int, timezone string) error
+	SetNotifyMentions(userID int, notify bool) error
 }
 
 type AuthService struct {
-	repo repository.Authorization
+	repo   repository.Authorization
+	badges Badge
 }
 
-func NewAuthService(repo repository.Authorization) *AuthService {
-	return &AuthService{repo: repo}
+func NewAuthService(repo repository.Authorization, badges Badge) *AuthService {
+	return &AuthService{repo: repo, badges: badges}
 }
 
 func (s *AuthService) CreateUser(user *models.User) error {
@@ -56,6 +60,7 @@ func (s *AuthService) CreateUser(user *models.User) error {
 	if err != nil {
 		return fmt.Errorf("service: create user: %w", err)
 	}
+	user.CreatedAt = time.Now()
 
 	return s.repo.CreateUser(user)
 }
@@ -75,7 +80,11 @@ func (s *AuthService) GenerateSessionToken(email, password string) (string, time
 	token := uuid.NewV4().String()
 	expiresAt := time.Now().Add(time.Hour * 12)
 
-	err = s.repo.AddSessionToken(email, token, expiresAt)
+	if err = s.repo.AddSessionToken(email, token, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.badges.Evaluate(models.Event{Kind: models.EventSignedIn, UserID: user.ID})
 
 	return token, expiresAt, nil
 }
@@ -111,6 +120,23 @@ func (s *AuthService) DeleteSessionToken(token string) error {
 	return nil
 }
 
+// SetTimezone stores the IANA timezone, such as "Europe/Berlin", times are
+// shown in for the user. An empty timezone means UTC.
+func (s *AuthService) SetTimezone(userID int, timezone string) error {
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return fmt.Errorf("service: set timezone: %w", ErrInvalidTimezone)
+		}
+	}
+	return s.repo.SetTimezone(userID, timezone)
+}
+
+// SetNotifyMentions turns the notifications about mentions of the user on
+// or off.
+func (s *AuthService) SetNotifyMentions(userID int, notify bool) error {
+	return s.repo.SetNotifyMentions(userID, notify)
+}
+
 func generateHashPassword(password string) (string, error) {
 	hashedPassword, hashingError := bcrypt.GenerateFromPassword([]byte(password), 10)
 
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"log"
+	"time"
+)
+
+var ErrBadgeNotFound = errors.New("badge not found")
+
+// badgeRule awards its badge to the user of an event of one of the kinds
+// it listens to, once the stats of the user earn it.
+type badgeRule struct {
+	badge  models.Badge
+	events []string
+	earned func(stats models.UserStats, now time.Time) bool
+}
+
+// badgeRules are the badges users can earn, in the order they are listed.
+var badgeRules = []badgeRule{
+	{
+		badge:  models.Badge{Slug: "first-post", Name: "First post", Description: "Published a first post."},
+		events: []string{models.EventPostPublished},
+		earned: func(stats models.UserStats, now time.Time) bool {
+			return stats.Posts >= 1
+		},
+	},
+	{
+		badge:  models.Badge{Slug: "helpful", Name: "Helpful", Description: "Had 10 answers accepted."},
+		events: []string{models.EventAnswerAccepted},
+		earned: func(stats models.UserStats, now time.Time) bool {
+			return stats.AcceptedAnswers >= 10
+		},
+	},
+	{
+		badge:  models.Badge{Slug: "well-liked", Name: "Well liked", Description: "Received 100 likes on posts and comments."},
+		events: []string{models.EventVoteReceived},
+		earned: func(stats models.UserStats, now time.Time) bool {
+			return stats.LikesReceived >= 100
+		},
+	},
+	{
+		badge:  models.Badge{Slug: "anniversary", Name: "Anniversary", Description: "Member for a year."},
+		events: []string{models.EventSignedIn},
+		earned: func(stats models.UserStats, now time.Time) bool {
+			return !stats.JoinedAt.IsZero() && !stats.JoinedAt.AddDate(1, 0, 0).After(now)
+		},
+	},
+}
+
+type Badge interface {
+	Evaluate(event models.Event)
+	AwardPastBadges() error
+	GetBadges() ([]models.Badge, error)
+	GetBadge(slug string) (models.Badge, []models.UserBadge, error)
+	GetUserBadges(userID int) ([]models.UserBadge, error)
+}
+
+type BadgeService struct {
+	repo repository.Badge
+}
+
+func NewBadgeService(repo repository.Badge) *BadgeService {
+	return &BadgeService{repo: repo}
+}
+
+// Evaluate runs the rules listening to the event and awards the user the
+// badges earned. Badges are a side effect of what the user did, which has
+// succeeded by now, so errors are logged rather than returned.
+func (b *BadgeService) Evaluate(event models.Event) {
+	if event.UserID == 0 {
+		return
+	}
+	if err := b.evaluate(event); err != nil {
+		log.Printf("badges: %v", err)
+	}
+}
+
+func (b *BadgeService) evaluate(event models.Event) error {
+	held, err := b.repo.GetUserBadges(event.UserID)
+	if err != nil {
+		return err
+	}
+	holds := make(map[string]bool, len(held))
+	for _, badge := range held {
+		holds[badge.Slug] = true
+	}
+
+	// The stats are only counted when the event may earn a badge the user
+	// does not hold yet.
+	var rules []badgeRule
+	for _, rule := range badgeRules {
+		for _, kind := range rule.events {
+			if kind == event.Kind && !holds[rule.badge.Slug] {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	stats, err := b.repo.GetUserStats(event.UserID)
+	if err != nil {
+		return err
+	}
+	return b.award(event.UserID, rules, stats, time.Now())
+}
+
+// AwardPastBadges runs every rule for every user, awarding the badges
+// earned before they were handed out or while an event went missing.
+func (b *BadgeService) AwardPastBadges() error {
+	stats, err := b.repo.GetAllUserStats()
+	if err != nil {
+		return err
+	}
+
+	holds := make(map[string]map[int]bool, len(badgeRules))
+	for _, rule := range badgeRules {
+		holders, err := b.repo.GetBadgeHolders(rule.badge.Slug)
+		if err != nil {
+			return err
+		}
+		holds[rule.badge.Slug] = make(map[int]bool, len(holders))
+		for _, holder := range holders {
+			holds[rule.badge.Slug][holder.UserID] = true
+		}
+	}
+
+	now := time.Now()
+	for userID, user := range stats {
+		var rules []badgeRule
+		for _, rule := range badgeRules {
+			if !holds[rule.badge.Slug][userID] {
+				rules = append(rules, rule)
+			}
+		}
+		if err := b.award(userID, rules, user, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// award gives the user the badges of the rules the stats of the user earn.
+func (b *BadgeService) award(userID int, rules []badgeRule, stats models.UserStats, now time.Time) error {
+	for _, rule := range rules {
+		if !rule.earned(stats, now) {
+			continue
+		}
+		if err := b.repo.AwardBadge(userID, rule.badge.Slug, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBadges lists every badge with the number of its holders.
+func (b *BadgeService) GetBadges() ([]models.Badge, error) {
+	counts, err := b.repo.CountBadgeHolders()
+	if err != nil {
+		return nil, err
+	}
+
+	badges := make([]models.Badge, len(badgeRules))
+	for i, rule := range badgeRules {
+		badges[i] = rule.badge
+		badges[i].Holders = counts[rule.badge.Slug]
+	}
+	return badges, nil
+}
+
+// GetBadge returns the badge with its holders, the latest first.
+func (b *BadgeService) GetBadge(slug string) (models.Badge, []models.UserBadge, error) {
+	badge, ok := findBadge(slug)
+	if !ok {
+		return models.Badge{}, nil, fmt.Errorf("service: get badge: %w", ErrBadgeNotFound)
+	}
+
+	holders, err := b.repo.GetBadgeHolders(slug)
+	if err != nil {
+		return models.Badge{}, nil, err
+	}
+	for i := range holders {
+		holders[i].Badge = badge
+	}
+	badge.Holders = len(holders)
+	return badge, holders, nil
+}
+
+// GetUserBadges returns the badges of the user in the order they were
+// awarded. Badges no longer defined are left out.
+func (b *BadgeService) GetUserBadges(userID int) ([]models.UserBadge, error) {
+	held, err := b.repo.GetUserBadges(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var badges []models.UserBadge
+	for _, badge := range held {
+		if definition, ok := findBadge(badge.Slug); ok {
+			badge.Badge = definition
+			badges = append(badges, badge)
+		}
+	}
+	return badges, nil
+}
+
+func findBadge(slug string) (models.Badge, bool) {
+	for _, rule := range badgeRules {
+		if rule.badge.Slug == slug {
+			return rule.badge, true
+		}
+	}
+	return models.Badge{}, false
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/repository"
+	"log"
+)
+
+var (
+	ErrBlobNotFound     = errors.New("file not found")
+	ErrInvalidSignature = errors.New("invalid or expired link")
+)
+
+type Blob interface {
+	ReadBlob(key string, expires int64, download, signature string) ([]byte, error)
+}
+
+type BlobService struct {
+	store repository.BlobStore
+}
+
+func NewBlobService(store repository.BlobStore) *BlobService {
+	return &BlobService{store: store}
+}
+
+// ReadBlob returns a blob for a signed download URL of the local store.
+func (b *BlobService) ReadBlob(key string, expires int64, download, signature string) ([]byte, error) {
+	if !b.store.Verify(key, expires, download, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	data, err := b.store.Get(key)
+	if err != nil {
+		if errors.Is(err, repository.ErrBlobNotFound) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("service: read blob: %w", err)
+	}
+	return data, nil
+}
+
+// pendingBlob is a file to put into the store along with the rows that
+// point to it.
+type pendingBlob struct {
+	key         string
+	contentType string
+	data        []byte
+}
+
+// putNew puts the blobs that are not stored yet. Keys are content hashes,
+// so an existing blob holds the same bytes. When one fails, the ones it
+// put are removed again. It runs inside the transaction writing the
+// rows that point to the blobs, so no other row can point to a blob that
+// was missing and removing those is safe.
+func putNew(store repository.BlobStore, blobs []pendingBlob) error {
+	var put []string
+	for _, blob := range blobs {
+		exists, err := store.Exists(blob.key)
+		if err == nil && !exists {
+			err = store.Put(blob.key, blob.contentType, blob.data)
+			put = append(put, blob.key)
+		}
+		if err != nil {
+			for _, key := range put {
+				if err := store.Delete(key); err != nil {
+					log.Printf("blobs: %v", err)
+				}
+			}
+			return fmt.Errorf("service: put blobs: %w", err)
+		}
+	}
+	return nil
+}
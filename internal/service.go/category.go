@@ -0,0 +1,158 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"sort"
+)
+
+var ErrCategoryNotFound = errors.New("category not found")
+
+type Category interface {
+	GetBoards(userID int) ([]*models.Category, error)
+	GetBoardByID(id, userID int) (*models.Category, error)
+	SetCategoryQA(categoryID int, qa bool) error
+}
+
+type CategoryService struct {
+	repo repository.Category
+	perm Permission
+}
+
+func NewCategoryService(repo repository.Category, perm Permission) *CategoryService {
+	return &CategoryService{repo: repo, perm: perm}
+}
+
+// GetBoards returns the top-level sections with their subforums attached.
+// Post counts and last posts of a section include all of its subforums.
+// Categories the user cannot read are left out.
+func (c *CategoryService) GetBoards(userID int) ([]*models.Category, error) {
+	byID, err := c.categoryTree(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get boards: %w", err)
+	}
+
+	var sections []*models.Category
+	for _, category := range byID {
+		if category.ParentID == 0 {
+			sections = append(sections, category)
+		}
+	}
+	sortCategories(sections)
+
+	for _, section := range sections {
+		if err := c.loadModerators(section); err != nil {
+			return nil, fmt.Errorf("service: get boards: %w", err)
+		}
+	}
+	return sections, nil
+}
+
+func (c *CategoryService) GetBoardByID(id, userID int) (*models.Category, error) {
+	byID, err := c.categoryTree(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get board: %w", err)
+	}
+
+	board, ok := byID[id]
+	if !ok {
+		return nil, ErrCategoryNotFound
+	}
+
+	if err := c.loadModerators(board); err != nil {
+		return nil, fmt.Errorf("service: get board: %w", err)
+	}
+	return board, nil
+}
+
+// SetCategoryQA turns the Q&A mode of the category on or off. Posts keep
+// their accepted answers while it is off.
+func (c *CategoryService) SetCategoryQA(categoryID int, qa bool) error {
+	if err := c.repo.SetCategoryQA(categoryID, qa); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("service: set category qa: %w", ErrCategoryNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+// categoryTree loads the categories readable by the user and links
+// subforums to their parents.
+func (c *CategoryService) categoryTree(userID int) (map[int]*models.Category, error) {
+	hidden, err := c.perm.HiddenCategories(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := c.repo.GetCategories(hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	isHidden := make(map[string]bool, len(hidden))
+	for _, name := range hidden {
+		isHidden[name] = true
+	}
+
+	byID := make(map[int]*models.Category, len(categories))
+	for i := range categories {
+		if !isHidden[categories[i].Name] {
+			byID[categories[i].ID] = &categories[i]
+		}
+	}
+
+	for _, category := range byID {
+		if parent, ok := byID[category.ParentID]; ok {
+			parent.Subforums = append(parent.Subforums, category)
+		}
+	}
+
+	for _, category := range byID {
+		sortCategories(category.Subforums)
+		if category.ParentID == 0 {
+			aggregateActivity(category)
+		}
+	}
+	return byID, nil
+}
+
+func (c *CategoryService) loadModerators(category *models.Category) error {
+	moderators, err := c.repo.GetModerators(category.ID)
+	if err != nil {
+		return err
+	}
+	category.Moderators = moderators
+
+	for _, sub := range category.Subforums {
+		if err := c.loadModerators(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregateActivity adds the post counts and latest posts of the subforums
+// to the category itself.
+func aggregateActivity(category *models.Category) {
+	for _, sub := range category.Subforums {
+		aggregateActivity(sub)
+		category.PostCount += sub.PostCount
+		if sub.LastPostID > category.LastPostID {
+			category.LastPostID = sub.LastPostID
+			category.LastPostTitle = sub.LastPostTitle
+		}
+	}
+}
+
+func sortCategories(categories []*models.Category) {
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Position != categories[j].Position {
+			return categories[i].Position < categories[j].Position
+		}
+		return categories[i].ID < categories[j].ID
+	})
+}
@@ -5,81 +5,584 @@ import (
 	"fmt"
 	"forum/internal/models"
 	"forum/internal/repository"
+	"html/template"
+	"log"
+	"sort"
 	"strings"
+	"time"
 )
 
-var ErrInvalidComment = errors.New("invalid comment")
+var (
+	ErrInvalidComment  = errors.New("invalid comment")
+	ErrCommentNotFound = errors.New("comment not found")
+)
 
 type Comment interface {
-	CreateComment(comment *models.Comment) error
-	GetComments(postID int) ([]*models.Comment, error)
+	CreateComment(comment *models.Comment, files []AttachmentFile) error
+	GetComments(postID int, order string, page int) (models.CommentPage, error)
+	GetCommentThread(postID, commentID int) (*models.Comment, error)
+	LocateComment(postID, commentID int, order string) (page, thread int, err error)
+	GetUserComments(userID, viewerID int) ([]*models.Comment, error)
 	GetCommentByID(commentID int) (models.Comment, error)
-	LikeComment(commentID int, username string) error
-	DislikeComment(commentID int, username string) error
+	UpdateComment(commentID, editorID int, text, reason string) error
+	GetCommentRevisions(commentID int) ([]models.CommentRevision, error)
+	LikeComment(commentID, userID int) error
+	DislikeComment(commentID, userID int) error
+	DeleteComment(commentID, userID int, reason string) error
+	AcceptAnswer(postID, commentID, userID int) error
 }
 
 type CommentService struct {
-	repo repository.Comment
+	repo          repository.Comment
+	posts         repository.PostItem
+	revisions     repository.Revision
+	perm          Permission
+	attachments   Attachment
+	notifications Notification
+	reactions     Reaction
+	reputation    Reputation
+	badges        Badge
+	maxDepth      int
+	perPage       int
 }
 
-func NewCommentService(repo repository.Comment) *CommentService {
-	return &CommentService{repo: repo}
+func NewCommentService(repo repository.Comment, posts repository.PostItem, revisions repository.Revision, perm Permission, attachments Attachment, notifications Notification, reactions Reaction, reputation Reputation, badges Badge, maxDepth, perPage int) *CommentService {
+	return &CommentService{
+		repo:          repo,
+		posts:         posts,
+		revisions:     revisions,
+		perm:          perm,
+		attachments:   attachments,
+		notifications: notifications,
+		reactions:     reactions,
+		reputation:    reputation,
+		badges:        badges,
+		maxDepth:      maxDepth,
+		perPage:       perPage,
+	}
 }
 
-func (c *CommentService) CreateComment(comment *models.Comment) error {
+// CreateComment stores the comment with its files and notifies the users
+// mentioned in it.
+// A comment with a ParentID replies to that comment, which must belong to
+// the same post.
+func (c *CommentService) CreateComment(comment *models.Comment, files []AttachmentFile) error {
 	if err := isValidComment(comment); err != nil {
 		return err
 	}
 
-	return c.repo.CreateComment(comment)
+	if comment.ParentID != 0 {
+		parent, err := c.GetCommentByID(comment.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent.PostID != comment.PostID {
+			return fmt.Errorf("service: create comment: %w", ErrInvalidComment)
+		}
+	}
+
+	uploads, err := c.attachments.PrepareAttachments(comment.UserID, files)
+	if err != nil {
+		return err
+	}
+
+	mentioned, err := c.notifications.MentionedUsers(comment.Text)
+	if err != nil {
+		return err
+	}
+
+	comment.TextHTML = template.HTML(renderMarkdown(comment.Text, false, userNames(mentioned)))
+	comment.CreatedAt = time.Now()
+	comment.UpdatedAt = comment.CreatedAt
+
+	uploaded, err := c.attachments.NewFiles(comment.UserID, nil, uploads)
+	if err != nil {
+		return err
+	}
+
+	if err := c.repo.CreateComment(comment, uploaded); err != nil {
+		return quotaError(err, uploaded)
+	}
+
+	// The comment is there by now, so failing to notify must not fail it.
+	if err := c.notifications.NotifyMentions(comment.UserID, mentioned, comment.PostID, comment.ID); err != nil {
+		log.Printf("notifications: %v", err)
+	}
+	return nil
 }
 
-func (c *CommentService) GetComments(postID int) ([]*models.Comment, error) {
-	return c.repo.GetComments(postID)
+// GetComments returns a page of the top-level comments of the post in the
+// given sort order, oldest first for unknown orders. Each comment comes
+// with its replies nested below it, down to the maximum depth. Deleted
+// comments with replies are kept as empty placeholders. Pages past the
+// last one are empty.
+func (c *CommentService) GetComments(postID int, order string, page int) (models.CommentPage, error) {
+	order = commentOrder(order)
+
+	ids, err := c.repo.GetRootCommentIDs(postID, order)
+	if err != nil {
+		return models.CommentPage{}, err
+	}
+
+	result := models.CommentPage{
+		Sort:  order,
+		Page:  page,
+		Pages: (len(ids) + c.perPage - 1) / c.perPage,
+	}
+	if page < 1 {
+		result.Page = 1
+	}
+	if result.Page > result.Pages {
+		return result, nil
+	}
+
+	start := (result.Page - 1) * c.perPage
+	end := start + c.perPage
+	if end > len(ids) {
+		end = len(ids)
+	}
+	ids = ids[start:end]
+
+	comments, err := c.loadComments(postID, ids)
+	if err != nil {
+		return models.CommentPage{}, err
+	}
+
+	roots := removeDeleted(buildTree(comments))
+	limitDepth(roots, c.maxDepth)
+
+	// The trees come oldest first; put them in the order of the page.
+	position := make(map[int]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return position[roots[i].ID] < position[roots[j].ID]
+	})
+
+	result.Comments = roots
+	return result, nil
 }
 
-func (c *CommentService) GetCommentByID(commentID int) (models.Comment, error) {
-	return c.repo.GetCommentByID(commentID)
+// GetCommentThread returns the comment with its replies nested below it,
+// down to the maximum depth counted from the comment. It continues a
+// thread cut off by GetComments.
+func (c *CommentService) GetCommentThread(postID, commentID int) (*models.Comment, error) {
+	comments, err := c.loadComments(postID, []int{commentID})
+	if err != nil {
+		return nil, err
+	}
+
+	removeDeleted(buildTree(comments))
+	for _, comment := range comments {
+		if comment.ID == commentID {
+			if comment.PostID != postID || comment.Deleted != nil && len(comment.Replies) == 0 {
+				break
+			}
+			limitDepth([]*models.Comment{comment}, c.maxDepth)
+			return comment, nil
+		}
+	}
+	return nil, fmt.Errorf("service: get comment thread: %w", ErrCommentNotFound)
 }
 
-func (c *CommentService) LikeComment(commentID int, username string) error {
-	if err := c.repo.CommentHasLike(commentID, username); err == nil {
-		if err := c.repo.RemoveLikeComment(commentID, username); err != nil {
-			return fmt.Errorf("service: like comment: %w", err)
+// LocateComment finds where the comment is shown: on the given page of
+// the comments of the post, or, when it is deeper than the maximum depth,
+// as the thread of its own.
+func (c *CommentService) LocateComment(postID, commentID int, order string) (page, thread int, err error) {
+	comment, err := c.repo.GetCommentByID(commentID)
+	if err != nil || comment.PostID != postID {
+		return 0, 0, fmt.Errorf("service: locate comment: %w", ErrCommentNotFound)
+	}
+
+	// Walk up to the top-level comment, whose position gives the page.
+	root, depth := comment, 0
+	for root.ParentID != 0 {
+		parent, err := c.repo.GetCommentByID(root.ParentID)
+		if err != nil {
+			break
 		}
-		return nil
+		root = parent
+		depth++
+	}
+
+	if depth >= c.maxDepth {
+		return 0, commentID, nil
 	}
 
-	if err := c.repo.CommentHasDislike(commentID, username); err == nil {
-		if err := c.repo.RemoveDislikeComment(commentID, username); err != nil {
-			return fmt.Errorf("service: like comment: %w", err)
+	ids, err := c.repo.GetRootCommentIDs(postID, commentOrder(order))
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, id := range ids {
+		if id == root.ID {
+			return i/c.perPage + 1, 0, nil
 		}
 	}
+	return 0, 0, fmt.Errorf("service: locate comment: %w", ErrCommentNotFound)
+}
+
+// commentOrder returns the sort order, or the default one for unknown
+// orders.
+func commentOrder(order string) string {
+	switch order {
+	case models.CommentsNewest, models.CommentsBest:
+		return order
+	default:
+		return models.CommentsOldest
+	}
+}
 
-	if err := c.repo.LikeComment(commentID, username); err != nil {
-		return fmt.Errorf("service: like comment: %w", err)
+// loadComments reads the comments with the given ids and all replies
+// below them, and fills in their attachments, reactions and rendered text.
+func (c *CommentService) loadComments(postID int, ids []int) ([]*models.Comment, error) {
+	comments, err := c.repo.GetCommentTrees(ids)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	attachments, err := c.attachments.GetCommentAttachments(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make([]int, len(comments))
+	for i, comment := range comments {
+		loaded[i] = comment.ID
+	}
+	reactions, err := c.reactions.GetReactions(models.TargetComment, loaded)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, comment := range comments {
+		if comment.Deleted != nil {
+			continue
+		}
+		comment.Attachments = attachments[comment.ID]
+		comment.Reactions = reactions[comment.ID]
+
+		rendered, fresh, err := cachedHTML(string(comment.TextHTML), comment.Text, false, c.notifications)
+		if err != nil {
+			return nil, err
+		}
+		if comment.TextHTML = rendered; !fresh {
+			if err := c.repo.SetCommentHTML(comment.ID, string(comment.TextHTML)); err != nil {
+				return nil, fmt.Errorf("service: get comments: %w", err)
+			}
+		}
+	}
+	return comments, nil
+}
+
+// buildTree links every comment to the replies it received and returns the
+// top-level comments. Replies to comments that are missing, because they
+// are in the trash, are treated as top-level comments.
+func buildTree(comments []*models.Comment) []*models.Comment {
+	byID := make(map[int]*models.Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	var roots []*models.Comment
+	for _, comment := range comments {
+		if parent, ok := byID[comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+	return roots
+}
+
+// removeDeleted drops the deleted comments that have no replies left and
+// empties the others, which stay as placeholders for their replies.
+func removeDeleted(comments []*models.Comment) []*models.Comment {
+	kept := comments[:0]
+	for _, comment := range comments {
+		comment.Replies = removeDeleted(comment.Replies)
+		if comment.Deleted != nil {
+			if len(comment.Replies) == 0 {
+				continue
+			}
+			comment.UserID, comment.Author = 0, ""
+			comment.Text, comment.TextHTML = "", ""
+			comment.Likes, comment.DisLikes = 0, 0
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// limitDepth cuts the trees off below depth levels. The comments on the
+// last level keep the number of replies that were cut off.
+func limitDepth(comments []*models.Comment, depth int) {
+	for _, comment := range comments {
+		if depth <= 1 {
+			comment.HiddenReplies = countReplies(comment)
+			comment.Replies = nil
+			continue
+		}
+		limitDepth(comment.Replies, depth-1)
+	}
+}
+
+// countReplies counts the replies below the comment, placeholders left
+// out.
+func countReplies(comment *models.Comment) int {
+	var n int
+	for _, reply := range comment.Replies {
+		if reply.Deleted == nil {
+			n++
+		}
+		n += countReplies(reply)
+	}
+	return n
 }
 
-func (c *CommentService) DislikeComment(commentID int, username string) error {
-	if err := c.repo.CommentHasDislike(commentID, username); err == nil {
-		if err := c.repo.RemoveDislikeComment(commentID, username); err != nil {
-			return fmt.Errorf("service: like comment: %w", err)
+// GetUserComments returns the comments of the user, leaving out those
+// under posts the viewer is not allowed to read.
+func (c *CommentService) GetUserComments(userID, viewerID int) ([]*models.Comment, error) {
+	comments, err := c.repo.GetCommentsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := c.perm.HiddenCategories(viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get user comments: %w", err)
+	}
+
+	isHidden := make(map[string]bool, len(hidden))
+	for _, name := range hidden {
+		isHidden[name] = true
+	}
+
+	readable := comments[:0]
+	postHidden := make(map[int]bool)
+	for _, comment := range comments {
+		skip, known := postHidden[comment.PostID]
+		if !known {
+			categories, err := c.posts.GetCategoriesByPostID(comment.PostID)
+			if err != nil {
+				return nil, fmt.Errorf("service: get user comments: %w", err)
+			}
+			skip = inHidden(categories, isHidden)
+			postHidden[comment.PostID] = skip
+		}
+		if skip {
+			continue
+		}
+
+		rendered, fresh, err := cachedHTML(string(comment.TextHTML), comment.Text, false, c.notifications)
+		if err != nil {
+			return nil, err
 		}
+		if comment.TextHTML = rendered; !fresh {
+			if err := c.repo.SetCommentHTML(comment.ID, string(comment.TextHTML)); err != nil {
+				return nil, fmt.Errorf("service: get user comments: %w", err)
+			}
+		}
+		readable = append(readable, comment)
+	}
+	return readable, nil
+}
+
+// readableComment returns ErrCommentNotFound for comments in the trash
+// and for comments under posts the user may not read.
+func (c *CommentService) readableComment(commentID, userID int) (models.Comment, error) {
+	comment, err := c.GetCommentByID(commentID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+
+	post, err := c.posts.GetPostByID(comment.PostID)
+	if err != nil {
+		return models.Comment{}, fmt.Errorf("service: get comment: %w: %v", ErrCommentNotFound, err)
+	}
+	if post.Deleted != nil || (post.Status != models.PostPublished && post.UserID != userID) {
+		return models.Comment{}, fmt.Errorf("service: get comment: %w", ErrCommentNotFound)
+	}
+
+	categories, err := c.posts.GetCategoriesByPostID(comment.PostID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+	ok, err := c.perm.CanRead(userID, categories)
+	if err != nil {
+		return models.Comment{}, err
+	}
+	if !ok {
+		return models.Comment{}, fmt.Errorf("service: get comment: %w", ErrCommentNotFound)
+	}
+	return comment, nil
+}
+
+// GetCommentByID returns ErrCommentNotFound for comments in the trash.
+func (c *CommentService) GetCommentByID(commentID int) (models.Comment, error) {
+	comment, err := c.repo.GetCommentByID(commentID)
+	if err != nil {
+		return models.Comment{}, fmt.Errorf("service: get comment: %w: %v", ErrCommentNotFound, err)
+	}
+	if comment.Deleted != nil {
+		return models.Comment{}, fmt.Errorf("service: get comment: %w", ErrCommentNotFound)
+	}
+	return comment, nil
+}
+
+// UpdateComment replaces the text of the comment and records the edit as
+// a revision. The first edit records the comment as it was written too.
+// Authors may edit their comments, moderators of the categories of the
+// post any comment under it.
+func (c *CommentService) UpdateComment(commentID, editorID int, text, reason string) error {
+	comment, err := c.GetCommentByID(commentID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.canChange(comment, editorID); err != nil {
+		return fmt.Errorf("service: update comment: %w", err)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxRevisionReason {
+		return fmt.Errorf("service: update comment: %w", ErrInvalidComment)
+	}
+
+	edited := &models.Comment{Text: text}
+	if err := isValidComment(edited); err != nil {
+		return err
+	}
+	if edited.Text == comment.Text {
 		return nil
 	}
-	if err := c.repo.CommentHasLike(commentID, username); err == nil {
-		if err := c.repo.RemoveLikeComment(commentID, username); err != nil {
-			return fmt.Errorf("service: like comment: %w", err)
+
+	mentioned, err := c.notifications.MentionedUsers(edited.Text)
+	if err != nil {
+		return err
+	}
+
+	revision := &models.CommentRevision{
+		CommentID: commentID,
+		EditorID:  editorID,
+		CreatedAt: time.Now(),
+		Text:      edited.Text,
+		Reason:    reason,
+	}
+	return c.repo.UpdateComment(revision, renderMarkdown(edited.Text, false, userNames(mentioned)))
+}
+
+// GetCommentRevisions returns the revisions of the comment, each with the
+// diff to the one before. Comments that were never edited have none.
+func (c *CommentService) GetCommentRevisions(commentID int) ([]models.CommentRevision, error) {
+	revisions, err := c.revisions.GetRevisionsByCommentID(commentID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get comment revisions: %w", err)
+	}
+
+	var previous string
+	for i := range revisions {
+		revisions[i].Diff = diffLines(previous, revisions[i].Text)
+		previous = revisions[i].Text
+	}
+	return revisions, nil
+}
+
+// DeleteComment moves the comment to the trash. Authors may delete their
+// comments, moderators of the categories of the post any comment under
+// it. A comment with replies leaves a placeholder behind.
+func (c *CommentService) DeleteComment(commentID, userID int, reason string) error {
+	comment, err := c.GetCommentByID(commentID)
+	if err != nil {
+		return err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxDeleteReason {
+		return fmt.Errorf("service: delete comment: %w", ErrInvalidComment)
+	}
+
+	if err := c.canChange(comment, userID); err != nil {
+		return fmt.Errorf("service: delete comment: %w", err)
+	}
+
+	return c.repo.DeleteComment(commentID, userID, reason, time.Now())
+}
+
+// AcceptAnswer marks the comment as the accepted answer to the question,
+// replacing the one accepted before. A zero commentID clears the accepted
+// answer. Only the author of the question may accept answers.
+func (c *CommentService) AcceptAnswer(postID, commentID, userID int) error {
+	post, err := c.posts.GetPostByID(postID)
+	if err != nil || post.Deleted != nil {
+		return fmt.Errorf("service: accept answer: %w", ErrPostNotFound)
+	}
+	if post.UserID != userID {
+		return fmt.Errorf("service: accept answer: %w", ErrPermissionDenied)
+	}
+	if !post.Question {
+		return fmt.Errorf("service: accept answer: %w", ErrInvalidComment)
+	}
+
+	var author int
+	if commentID != 0 {
+		comment, err := c.GetCommentByID(commentID)
+		if err != nil {
+			return err
 		}
+		if comment.PostID != postID {
+			return fmt.Errorf("service: accept answer: %w", ErrCommentNotFound)
+		}
+		author = comment.UserID
+	}
+
+	if err := c.posts.SetAcceptedAnswer(postID, commentID); err != nil {
+		return err
+	}
+	c.badges.Evaluate(models.Event{Kind: models.EventAnswerAccepted, UserID: author})
+	return nil
+}
+
+// canChange returns ErrPermissionDenied unless the user wrote the comment
+// or moderates a category of its post.
+func (c *CommentService) canChange(comment models.Comment, userID int) error {
+	if userID != 0 && comment.UserID == userID {
+		return nil
+	}
+
+	categories, err := c.posts.GetCategoriesByPostID(comment.PostID)
+	if err != nil {
+		return err
 	}
+	if !c.perm.CanModeratePost(userID, categories) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// LikeComment likes the comment, or takes the like back when the user
+// liked it already. A dislike of the user turns into the like.
+func (c *CommentService) LikeComment(commentID, userID int) error {
+	return c.vote(commentID, userID, models.ReactionLike)
+}
 
-	if err := c.repo.DislikeComment(commentID, username); err != nil {
-		return fmt.Errorf("service: like comment: %w", err)
+// DislikeComment is LikeComment for dislikes.
+func (c *CommentService) DislikeComment(commentID, userID int) error {
+	return c.vote(commentID, userID, models.ReactionDislike)
+}
+
+// vote toggles the like or dislike of the user and updates the reputation
+// of the author of the comment to match the vote the user is left with.
+func (c *CommentService) vote(commentID, userID int, kind string) error {
+	comment, err := c.readableComment(commentID, userID)
+	if err != nil {
+		return err
 	}
 
+	if err := c.reputation.Vote(userID, comment.UserID, models.TargetComment, commentID, kind); err != nil {
+		return err
+	}
+	c.badges.Evaluate(models.Event{Kind: models.EventVoteReceived, UserID: comment.UserID})
 	return nil
 }
 
@@ -91,7 +594,7 @@ func isValidComment(comment *models.Comment) error {
 	comment.Text = strings.Trim(comment.Text, " \n\r")
 
 	for _, char := range comment.Text {
-		if (char != 13 && char != 10) && (char < 32 || char > 126) {
+		if (char != 13 && char != 10 && char != 9) && (char < 32 || char > 126) {
 			return fmt.Errorf("service: CreatePost: isValidComment err: %w", ErrInvalidComment)
 		}
 	}
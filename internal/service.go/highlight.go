@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var ErrCodeBlockNotFound = errors.New("code block not found")
+
+var codeFormatter = chromahtml.New(
+	chromahtml.WithClasses(true),
+	chromahtml.WithLineNumbers(true),
+	chromahtml.LineNumbersInTable(true),
+	chromahtml.TabWidth(4),
+)
+
+// codeRenderer highlights fenced and indented code blocks with chroma. The
+// output uses CSS classes only, see web/static/css/highlight.css. When
+// rawLinks is set, every block links to "?raw=N" which the post page serves
+// as plain text. A codeRenderer numbers blocks, so use one per document.
+type codeRenderer struct {
+	rawLinks bool
+	blocks   int
+}
+
+func (c *codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, c.renderCode)
+	reg.Register(ast.KindCodeBlock, c.renderCode)
+}
+
+func (c *codeRenderer) renderCode(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	c.blocks++
+
+	var language string
+	if fenced, ok := node.(*ast.FencedCodeBlock); ok {
+		language = string(fenced.Language(source))
+	}
+	code := codeText(node, source)
+
+	lexer := detectLexer(language, code)
+
+	w.WriteString(`<div class="code-block"><div class="code-toolbar"><span class="code-lang">`)
+	w.WriteString(template.HTMLEscapeString(languageName(lexer)))
+	w.WriteString(`</span>`)
+	if c.rawLinks {
+		fmt.Fprintf(w, `<a class="code-raw" href="?raw=%d">raw</a>`, c.blocks)
+	}
+	w.WriteString(`</div>`)
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err == nil {
+		err = codeFormatter.Format(w, styles.Fallback, iterator)
+	}
+	if err != nil {
+		w.WriteString(`<pre><code>` + template.HTMLEscapeString(code) + `</code></pre>`)
+	}
+
+	w.WriteString(`</div>`)
+	return ast.WalkSkipChildren, nil
+}
+
+// languageHints recognise the languages most discussed on the forum when
+// chroma's own analysers give up. They are tried in order.
+var languageHints = []struct {
+	lexer   string
+	pattern *regexp.Regexp
+}{
+	{"go", regexp.MustCompile(`(?m)^(package \w+|func (\(\w+ \*?\w+\) )?\w+\(|import \()`)},
+	{"docker", regexp.MustCompile(`(?m)^FROM \S+`)},
+	{"sql", regexp.MustCompile(`(?im)^\s*(SELECT|INSERT INTO|UPDATE \w+ SET|DELETE FROM|CREATE (TABLE|INDEX|VIEW)|ALTER TABLE)\b`)},
+	{"python", regexp.MustCompile(`(?m)^(def \w+\(.*\):|class \w+.*:|from [\w.]+ import |import \w+$)`)},
+	{"javascript", regexp.MustCompile(`(?m)(^(const|let|var) \w+ =|=> \{|function \w*\(|console\.log\()`)},
+}
+
+// detectLexer picks the lexer named in the fence info string and falls back
+// to guessing the language from the code itself.
+func detectLexer(language, code string) chroma.Lexer {
+	if language != "" {
+		if lexer := lexers.Get(language); lexer != nil {
+			return lexer
+		}
+	}
+
+	if lexer := lexers.Analyse(code); lexer != nil {
+		return lexer
+	}
+
+	for _, hint := range languageHints {
+		if hint.pattern.MatchString(code) {
+			return lexers.Get(hint.lexer)
+		}
+	}
+	return lexers.Fallback
+}
+
+func languageName(lexer chroma.Lexer) string {
+	if lexer == lexers.Fallback {
+		return "Plain text"
+	}
+	return lexer.Config().Name
+}
+
+func codeText(node ast.Node, source []byte) string {
+	var code strings.Builder
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+	return code.String()
+}
+
+// codeBlock returns the raw text of the n-th code block of the source,
+// counting from 1 in the order the blocks are rendered.
+func codeBlock(source string, n int) (string, error) {
+	src := []byte(source)
+	doc := newMarkdown(false, &mentionParser{}).Parser().Parse(text.NewReader(src))
+
+	var (
+		found string
+		count int
+	)
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if node.Kind() != ast.KindFencedCodeBlock && node.Kind() != ast.KindCodeBlock {
+			return ast.WalkContinue, nil
+		}
+		count++
+		if count == n {
+			found = codeText(node, src)
+			return ast.WalkStop, nil
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	if count != n {
+		return "", ErrCodeBlockNotFound
+	}
+	return found, nil
+}
@@ -0,0 +1,527 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrInvalidImage  = errors.New("invalid image")
+	ErrImageNotFound = errors.New("image not found")
+)
+
+const (
+	MaxImageSize   = 5 << 20
+	MaxPostImages  = 4
+	maxImagePixels = 40 << 20
+	maxGIFFrames   = 300
+	jpegQuality    = 90
+	thumbQuality   = 85
+	uploadURL      = "/uploads/"
+
+	// maxGIFPixels caps the pixels of all frames of a GIF together. Frames
+	// take a byte a pixel, a quarter of what decoded stills take.
+	maxGIFPixels = 4 * maxImagePixels
+)
+
+// ThumbnailWidths are the widths thumbnails are generated in. A thumbnail
+// is stored next to its original under the key w<width>/<filename>.
+var ThumbnailWidths = []int{320, 640, 1024}
+
+var uploadName = regexp.MustCompile(`^[0-9a-f]{64}\.(jpg|png|gif)$`)
+
+// imageExtensions lists the accepted formats by sniffed content type. WebP
+// has no encoder in the standard library, so it is stored as PNG.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".png",
+}
+
+type Image interface {
+	PrepareImages(uploads [][]byte) ([]*ImageUpload, error)
+	GetPostImages(postID int) ([]models.Image, error)
+	DeletePostImages(postID int) error
+	ImageURL(key string) (string, error)
+	GetImagePostIDs(key string) ([]int, error)
+}
+
+// ImageUpload is a validated and re-encoded image waiting for its post.
+type ImageUpload struct {
+	models.Image
+	data []byte
+}
+
+type ImageService struct {
+	repo   repository.Image
+	store  repository.BlobStore
+	expiry time.Duration
+	// mu serialises thumbnail generation, which keeps concurrent first
+	// requests from decoding the same original several times at once.
+	mu sync.Mutex
+}
+
+func NewImageService(repo repository.Image, store repository.BlobStore, expiry time.Duration) *ImageService {
+	return &ImageService{repo: repo, store: store, expiry: expiry}
+}
+
+// PrepareImages checks every upload before anything is stored, so a post is
+// never created with only some of its images.
+func (i *ImageService) PrepareImages(uploads [][]byte) ([]*ImageUpload, error) {
+	if len(uploads) > MaxPostImages {
+		return nil, fmt.Errorf("service: prepare images: %w: at most %d images per post", ErrInvalidImage, MaxPostImages)
+	}
+
+	images := make([]*ImageUpload, 0, len(uploads))
+	for _, data := range uploads {
+		upload, err := reencodeImage(data)
+		if err != nil {
+			return nil, fmt.Errorf("service: prepare images: %w", err)
+		}
+		images = append(images, upload)
+	}
+	return images, nil
+}
+
+// GetPostImages returns the images of a post with their thumbnail URLs.
+func (i *ImageService) GetPostImages(postID int) ([]models.Image, error) {
+	images, err := i.repo.GetImagesByPostID(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	for n := range images {
+		setThumbnails(&images[n])
+	}
+	return images, nil
+}
+
+// setThumbnails fills in the srcset of img and its smallest rendition.
+// Only widths below the original are offered.
+func setThumbnails(img *models.Image) {
+	original := uploadURL + img.Filename
+	img.Preview = original
+
+	var srcset []string
+	for _, width := range ThumbnailWidths {
+		if width >= img.Width {
+			break
+		}
+		url := fmt.Sprintf("%sw%d/%s", uploadURL, width, img.Filename)
+		if len(srcset) == 0 {
+			img.Preview = url
+		}
+		srcset = append(srcset, fmt.Sprintf("%s %dw", url, width))
+	}
+	img.Srcset = strings.Join(append(srcset, fmt.Sprintf("%s %dw", original, img.Width)), ", ")
+}
+
+// ImageURL returns a signed download URL for an image key as used in the
+// srcset, "<filename>" or "w<width>/<filename>". Missing thumbnails are
+// generated from the original first.
+func (i *ImageService) ImageURL(key string) (string, error) {
+	filename, width, ok := parseImageKey(key)
+	if !ok {
+		return "", ErrImageNotFound
+	}
+
+	if width > 0 {
+		if err := i.thumbnail(filename, width); err != nil {
+			return "", err
+		}
+	}
+
+	return i.store.URL(key, i.expiry, "")
+}
+
+// GetImagePostIDs returns the posts that show the image under key. The
+// image may be served to whoever can read one of them.
+func (i *ImageService) GetImagePostIDs(key string) ([]int, error) {
+	filename, _, ok := parseImageKey(key)
+	if !ok {
+		return nil, ErrImageNotFound
+	}
+	return i.repo.GetPostIDsByFilename(filename)
+}
+
+// parseImageKey splits an image key into the filename of the original and
+// the thumbnail width, which is 0 for the original itself.
+func parseImageKey(key string) (filename string, width int, ok bool) {
+	filename = key
+	if size, name, found := strings.Cut(key, "/"); found {
+		w, err := strconv.Atoi(strings.TrimPrefix(size, "w"))
+		if err != nil || !strings.HasPrefix(size, "w") || !isThumbnailWidth(w) {
+			return "", 0, false
+		}
+		filename, width = name, w
+	}
+	if !uploadName.MatchString(filename) {
+		return "", 0, false
+	}
+	return filename, width, true
+}
+
+func (i *ImageService) thumbnail(filename string, width int) error {
+	key := fmt.Sprintf("w%d/%s", width, filename)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	exists, err := i.store.Exists(key)
+	if err != nil {
+		return fmt.Errorf("service: thumbnail: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	data, err := i.store.Get(filename)
+	if err != nil {
+		if errors.Is(err, repository.ErrBlobNotFound) {
+			return ErrImageNotFound
+		}
+		return fmt.Errorf("service: thumbnail: %w", err)
+	}
+
+	thumb, err := resizeImage(data, path.Ext(filename), width)
+	if err != nil {
+		return fmt.Errorf("service: thumbnail: %w", err)
+	}
+
+	if err = i.store.Put(key, mime.TypeByExtension(path.Ext(filename)), thumb); err != nil {
+		return fmt.Errorf("service: thumbnail: %w", err)
+	}
+	return nil
+}
+
+func isThumbnailWidth(width int) bool {
+	for _, w := range ThumbnailWidths {
+		if w == width {
+			return true
+		}
+	}
+	return false
+}
+
+// resizeImage scales a stored image down to width, keeping the aspect ratio
+// and the format of the original. Animated GIFs keep their first frame.
+func resizeImage(data []byte, ext string, width int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	if b.Dx() <= width {
+		return data, nil
+	}
+
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	switch ext {
+	case ".jpg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbQuality})
+	case ".gif":
+		err = gif.Encode(&buf, dst, nil)
+	default:
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DeletePostImages removes the images of a post. Stored files and their
+// thumbnails are removed once no other post refers to them.
+func (i *ImageService) DeletePostImages(postID int) error {
+	return i.repo.DeleteImagesByPostID(postID, func(filename string) error {
+		keys := []string{filename}
+		for _, width := range ThumbnailWidths {
+			keys = append(keys, fmt.Sprintf("w%d/%s", width, filename))
+		}
+
+		for _, key := range keys {
+			if err := i.store.Delete(key); err != nil {
+				return fmt.Errorf("service: delete post images: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// reencodeImage decodes the upload and encodes it again. Only the pixels
+// survive, which drops EXIF and any other metadata or trailing data.
+func reencodeImage(data []byte) (*ImageUpload, error) {
+	if len(data) > MaxImageSize {
+		return nil, fmt.Errorf("%w: larger than %d MB", ErrInvalidImage, MaxImageSize>>20)
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidImage, contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels is too large", ErrInvalidImage, config.Width, config.Height)
+	}
+
+	var (
+		buf    bytes.Buffer
+		bounds image.Rectangle
+	)
+	switch contentType {
+	case "image/gif":
+		// Keep every frame of animated GIFs. The frames are counted before
+		// they are decoded, as a small file can hold a great many.
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		if frames > maxGIFFrames {
+			return nil, fmt.Errorf("%w: more than %d frames", ErrInvalidImage, maxGIFFrames)
+		}
+		if pixels > maxGIFPixels {
+			return nil, fmt.Errorf("%w: the frames have too many pixels", ErrInvalidImage)
+		}
+
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		if err = gif.EncodeAll(&buf, g); err != nil {
+			return nil, fmt.Errorf("service: encode gif: %w", err)
+		}
+		bounds = image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		// The orientation tag is about to be stripped, so apply it now.
+		img = orient(img, exifOrientation(data))
+		if err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("service: encode jpeg: %w", err)
+		}
+		bounds = img.Bounds()
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		if err = png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("service: encode png: %w", err)
+		}
+		bounds = img.Bounds()
+		contentType = "image/png"
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return &ImageUpload{
+		Image: models.Image{
+			Filename:    hex.EncodeToString(sum[:]) + ext,
+			ContentType: contentType,
+			Width:       bounds.Dx(),
+			Height:      bounds.Dy(),
+			Size:        buf.Len(),
+		},
+		data: buf.Bytes(),
+	}, nil
+}
+
+// exifOrientation returns the orientation tag (1-8) of a JPEG, or 1 when
+// the file has none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			break
+		}
+
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// gifFrames walks the blocks of a GIF without decoding them and returns
+// the number of frames and the pixels of all frames together.
+func gifFrames(data []byte) (frames int, pixels int64, err error) {
+	errTruncated := errors.New("gif: truncated file")
+	if len(data) < 13 {
+		return 0, 0, errTruncated
+	}
+
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks moves pos past a run of data sub-blocks.
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errTruncated
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				return nil
+			}
+		}
+	}
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return 0, 0, errTruncated
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			frames++
+			pixels += width * height
+
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++ // LZW minimum code size
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, fmt.Errorf("gif: unknown block 0x%02x", data[pos])
+		}
+	}
+	return 0, 0, errTruncated
+}
+
+// orient rotates and flips img so that it displays upright for the given
+// EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
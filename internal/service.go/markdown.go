@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// renderVersion prefixes every cached rendering. Bump it whenever the
+// renderer output changes so stale cached HTML gets rendered again.
+const renderVersion = "<!-- render v3 -->"
+
+type Markdown interface {
+	Preview(source string) template.HTML
+	CodeBlock(source string, n int) (string, error)
+}
+
+type MarkdownService struct{}
+
+func NewMarkdownService() *MarkdownService {
+	return &MarkdownService{}
+}
+
+func (m *MarkdownService) Preview(source string) template.HTML {
+	return template.HTML(strings.TrimPrefix(renderMarkdown(source, false, nil), renderVersion))
+}
+
+func (m *MarkdownService) CodeBlock(source string, n int) (string, error) {
+	return codeBlock(source, n)
+}
+
+// newMarkdown builds a converter for a single document, see codeRenderer
+// and mentionParser.
+func newMarkdown(rawLinks bool, mentions *mentionParser) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+			extension.Linkify,
+		),
+		goldmark.WithParserOptions(
+			parser.WithInlineParsers(util.Prioritized(mentions, 500)),
+		),
+		goldmark.WithRendererOptions(
+			html.WithHardWraps(),
+			renderer.WithNodeRenderers(util.Prioritized(&codeRenderer{rawLinks: rawLinks}, 100)),
+		),
+	)
+}
+
+var sanitizer = newSanitizer()
+
+// newSanitizer allows only the elements CommonMark and the table extension
+// produce. Everything else, including raw HTML in the source, is dropped.
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowElements(
+		"p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "ul", "ol", "li", "pre", "code", "em", "strong", "del",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+
+	p.AllowStandardURLs()
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+
+	// Highlighted code blocks, see codeRenderer.
+	p.AllowElements("div", "span")
+	p.AllowAttrs("class").Matching(highlightClass).OnElements("div", "span", "pre", "code", "table", "tr", "td", "a")
+
+	return p
+}
+
+// highlightClass matches the classes of the code block wrapper and the
+// short token classes chroma emits, such as "k" or "nx".
+var highlightClass = regexp.MustCompile(`^(code-block|code-toolbar|code-lang|code-raw|chroma|lntable|lntd|lnt|ln|line|cl|hl|[a-z]{1,2}[a-z0-9]?)$`)
+
+// renderMarkdown converts CommonMark source into sanitised HTML prefixed
+// with renderVersion, ready to be cached next to the source. Post bodies
+// set rawLinks so their code blocks link to a plain text view. Mentions of
+// the names in mentioned link to their profiles.
+func renderMarkdown(source string, rawLinks bool, mentioned map[string]bool) string {
+	var buf bytes.Buffer
+	if err := newMarkdown(rawLinks, &mentionParser{link: mentioned}).Convert([]byte(source), &buf); err != nil {
+		return renderVersion + template.HTMLEscapeString(source)
+	}
+
+	return renderVersion + sanitizer.Sanitize(buf.String())
+}
+
+// cachedHTML returns the cached rendering, or renders the source again when
+// the cache is empty or was produced by an older renderer. Mentions are
+// looked up again for the new rendering.
+func cachedHTML(cached, source string, rawLinks bool, mentions Notification) (template.HTML, bool, error) {
+	if strings.HasPrefix(cached, renderVersion) {
+		return template.HTML(cached), true, nil
+	}
+
+	mentioned, err := mentions.MentionedUsers(source)
+	if err != nil {
+		return "", false, err
+	}
+	return template.HTML(renderMarkdown(source, rawLinks, userNames(mentioned))), false, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"forum/internal/models"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// maxMentions is how many different users one post or comment can mention.
+// Further mentions are shown as plain text.
+const maxMentions = 10
+
+// mentionParser reads "@name" mentions. It records every name it finds and
+// turns the mentions of the names in link into links to their profiles.
+// Mentions in code spans and code blocks are never seen by the parser.
+type mentionParser struct {
+	link  map[string]bool
+	names []string
+}
+
+func (m *mentionParser) Trigger() []byte {
+	return []byte{'@'}
+}
+
+func (m *mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// An "@" right after a name character is part of an email address.
+	if isMentionChar(block.PrecendingCharacter()) {
+		return nil
+	}
+
+	line, _ := block.PeekLine()
+	end := 1
+	for end < len(line) && isMentionChar(rune(line[end])) {
+		end++
+	}
+	// A mention at the end of a sentence keeps the full stop out.
+	name := strings.TrimRight(string(line[1:end]), ".-")
+	if name == "" {
+		return nil
+	}
+
+	m.names = append(m.names, name)
+	if !m.link[name] {
+		return nil
+	}
+
+	block.Advance(1 + len(name))
+	link := ast.NewLink()
+	link.Destination = []byte("/u/" + url.PathEscape(name))
+	link.AppendChild(link, ast.NewString([]byte("@"+name)))
+	return link
+}
+
+// isMentionChar reports whether r can be part of a mentioned name. Names
+// with other characters, such as spaces, cannot be mentioned.
+func isMentionChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-'
+}
+
+// mentionNames returns the names mentioned in the markdown source, once
+// each and at most maxMentions of them.
+func mentionNames(source string) []string {
+	mentions := &mentionParser{}
+	newMarkdown(false, mentions).Parser().Parse(text.NewReader([]byte(source)))
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range mentions.names {
+		if seen[name] || len(names) == maxMentions {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// userNames returns the set of the names of the users.
+func userNames(users []models.User) map[string]bool {
+	names := make(map[string]bool, len(users))
+	for _, user := range users {
+		names[user.Username] = true
+	}
+	return names
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"time"
+)
+
+// maxNotifications is how many of the latest notifications are listed.
+const maxNotifications = 100
+
+type Notification interface {
+	MentionedUsers(source string) ([]models.User, error)
+	NotifyMentions(actorID int, mentioned []models.User, postID, commentID int) error
+	GetNotifications(userID int) ([]models.Notification, error)
+	MarkNotificationsRead(userID int) error
+	BlockUser(userID int, username string) error
+	UnblockUser(userID int, username string) error
+	IsBlocked(userID, blockedID int) (bool, error)
+	GetBlockedUsers(userID int) ([]models.User, error)
+}
+
+type NotificationService struct {
+	repo  repository.Notification
+	users repository.Authorization
+	posts repository.PostItem
+	perm  Permission
+}
+
+func NewNotificationService(repo repository.Notification, users repository.Authorization, posts repository.PostItem, perm Permission) *NotificationService {
+	return &NotificationService{repo: repo, users: users, posts: posts, perm: perm}
+}
+
+// MentionedUsers returns the users mentioned in the markdown source.
+// Mentions of names nobody has are ignored.
+func (n *NotificationService) MentionedUsers(source string) ([]models.User, error) {
+	var users []models.User
+	for _, name := range mentionNames(source) {
+		user, err := n.users.GetUserByUsername(name)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("service: mentioned users: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// NotifyMentions tells the mentioned users that the actor mentioned them in
+// the post, or in the comment when commentID is set. Users are left out
+// when they mentioned themselves, turned mention notifications off,
+// blocked the actor or cannot read the post. Nobody is notified about
+// posts that are not published.
+func (n *NotificationService) NotifyMentions(actorID int, mentioned []models.User, postID, commentID int) error {
+	if len(mentioned) == 0 {
+		return nil
+	}
+
+	post, err := n.posts.GetPostByID(postID)
+	if err != nil {
+		return fmt.Errorf("service: notify mentions: %w", err)
+	}
+	if post.Deleted != nil || post.Status != models.PostPublished {
+		return nil
+	}
+
+	categories, err := n.posts.GetCategoriesByPostID(postID)
+	if err != nil {
+		return fmt.Errorf("service: notify mentions: %w", err)
+	}
+
+	for _, user := range mentioned {
+		if user.ID == actorID || !user.NotifyMentions {
+			continue
+		}
+
+		blocked, err := n.repo.IsBlocked(user.ID, actorID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			continue
+		}
+
+		ok, err := n.perm.CanRead(user.ID, categories)
+		if err != nil {
+			return fmt.Errorf("service: notify mentions: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		notification := &models.Notification{
+			UserID:    user.ID,
+			ActorID:   actorID,
+			Kind:      models.NotificationMention,
+			PostID:    postID,
+			CommentID: commentID,
+			CreatedAt: time.Now(),
+		}
+		if err := n.repo.CreateNotification(notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetNotifications returns the latest notifications of the user, leaving
+// out those about posts the user may no longer read.
+func (n *NotificationService) GetNotifications(userID int) ([]models.Notification, error) {
+	notifications, err := n.repo.GetNotifications(userID, maxNotifications)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := n.perm.HiddenCategories(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get notifications: %w", err)
+	}
+	if len(hidden) == 0 {
+		return notifications, nil
+	}
+
+	isHidden := make(map[string]bool, len(hidden))
+	for _, name := range hidden {
+		isHidden[name] = true
+	}
+
+	readable := notifications[:0]
+	postHidden := make(map[int]bool)
+	for _, notification := range notifications {
+		skip, known := postHidden[notification.PostID]
+		if !known {
+			categories, err := n.posts.GetCategoriesByPostID(notification.PostID)
+			if err != nil {
+				return nil, fmt.Errorf("service: get notifications: %w", err)
+			}
+			skip = inHidden(categories, isHidden)
+			postHidden[notification.PostID] = skip
+		}
+		if !skip {
+			readable = append(readable, notification)
+		}
+	}
+	return readable, nil
+}
+
+func (n *NotificationService) MarkNotificationsRead(userID int) error {
+	return n.repo.MarkNotificationsRead(userID, time.Now())
+}
+
+// BlockUser keeps the named user from notifying the user.
+func (n *NotificationService) BlockUser(userID int, username string) error {
+	blocked, err := n.users.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("service: block user: %w", ErrUserNotFound)
+	}
+	if blocked.ID == userID {
+		return fmt.Errorf("service: block user: %w", ErrInvalidUsername)
+	}
+	return n.repo.BlockUser(userID, blocked.ID)
+}
+
+func (n *NotificationService) UnblockUser(userID int, username string) error {
+	blocked, err := n.users.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("service: unblock user: %w", ErrUserNotFound)
+	}
+	return n.repo.UnblockUser(userID, blocked.ID)
+}
+
+func (n *NotificationService) IsBlocked(userID, blockedID int) (bool, error) {
+	return n.repo.IsBlocked(userID, blockedID)
+}
+
+func (n *NotificationService) GetBlockedUsers(userID int) ([]models.User, error) {
+	return n.repo.GetBlockedUsers(userID)
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidGroup     = errors.New("invalid group")
+)
+
+const adminGroup = "admin"
+
+type Permission interface {
+	IsAdmin(userID int) bool
+	IsModerator(userID int) bool
+	HiddenCategories(userID int) ([]string, error)
+	CanRead(userID int, categories []string) (bool, error)
+	CanPost(userID int, category string) (bool, error)
+	CanModerate(userID int, category string) (bool, error)
+	CanModeratePost(userID int, categories []string) bool
+	GetGroups() ([]models.Group, error)
+	CreateGroup(name string) error
+	AddGroupMember(groupID int, username string) error
+	RemoveGroupMember(groupID, userID int) error
+	GetCategoryPermissions() ([]models.CategoryPermission, error)
+	SetCategoryPermission(perm models.CategoryPermission) error
+	DeleteCategoryPermission(categoryID, groupID int) error
+}
+
+type PermissionService struct {
+	repo       repository.Permission
+	categories repository.Category
+	users      repository.Authorization
+
+	mu    sync.Mutex
+	rules *permissionRules
+}
+
+// permissionRules are the parts of the permissions shared by all users.
+// They are loaded once and dropped whenever an administrator changes the
+// groups or the rules of a category; categories are only set up when the
+// database is created.
+type permissionRules struct {
+	categories []models.Category
+	byID       map[int]models.Category
+	perms      map[int][]models.CategoryPermission
+	adminGroup int
+}
+
+func NewPermissionService(repo repository.Permission, categories repository.Category, users repository.Authorization) *PermissionService {
+	return &PermissionService{repo: repo, categories: categories, users: users}
+}
+
+// access holds the effective rights of one user, keyed by category name.
+type access struct {
+	read     map[string]bool
+	post     map[string]bool
+	moderate map[string]bool
+}
+
+// accessFor resolves the rights of the user on every category. A category
+// without rules of its own inherits the rules of its closest ancestor; when
+// no ancestor has rules either, the category is public.
+func (p *PermissionService) accessFor(userID int) (*access, error) {
+	shared, err := p.loadRules()
+	if err != nil {
+		return nil, err
+	}
+	rules, byID := shared.perms, shared.byID
+
+	member := make(map[int]bool)
+	moderates := make(map[int]bool)
+	if userID != 0 {
+		groupIDs, err := p.repo.GetUserGroupIDs(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range groupIDs {
+			member[id] = true
+		}
+
+		categoryIDs, err := p.categories.GetModeratedCategoryIDs(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range categoryIDs {
+			moderates[id] = true
+		}
+	}
+
+	admin := shared.adminGroup != 0 && member[shared.adminGroup]
+
+	acc := &access{
+		read:     make(map[string]bool),
+		post:     make(map[string]bool),
+		moderate: make(map[string]bool),
+	}
+
+	for _, c := range shared.categories {
+		if admin {
+			acc.read[c.Name], acc.post[c.Name], acc.moderate[c.Name] = true, true, true
+			continue
+		}
+
+		own := c
+		for len(rules[own.ID]) == 0 && own.ParentID != 0 {
+			own = byID[own.ParentID]
+		}
+
+		acc.read[c.Name] = len(rules[own.ID]) == 0
+		acc.post[c.Name] = len(rules[own.ID]) == 0 && userID != 0
+		acc.moderate[c.Name] = false
+
+		for _, perm := range rules[own.ID] {
+			if !member[perm.GroupID] {
+				continue
+			}
+			acc.read[c.Name] = acc.read[c.Name] || perm.CanRead || perm.CanModerate
+			acc.post[c.Name] = acc.post[c.Name] || perm.CanPost
+			acc.moderate[c.Name] = acc.moderate[c.Name] || perm.CanModerate
+		}
+
+		if isCategoryModerator(c, byID, moderates) {
+			acc.read[c.Name], acc.post[c.Name], acc.moderate[c.Name] = true, true, true
+		}
+	}
+	return acc, nil
+}
+
+// loadRules returns the shared rules, loading them when they were dropped.
+func (p *PermissionService) loadRules() (*permissionRules, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rules != nil {
+		return p.rules, nil
+	}
+
+	categories, err := p.categories.GetCategories(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := p.repo.GetCategoryPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &permissionRules{
+		categories: categories,
+		byID:       make(map[int]models.Category, len(categories)),
+		perms:      make(map[int][]models.CategoryPermission),
+	}
+	for _, c := range categories {
+		rules.byID[c.ID] = c
+	}
+	for _, perm := range perms {
+		rules.perms[perm.CategoryID] = append(rules.perms[perm.CategoryID], perm)
+	}
+	if group, err := p.repo.GetGroupByName(adminGroup); err == nil {
+		rules.adminGroup = group.ID
+	}
+
+	p.rules = rules
+	return rules, nil
+}
+
+// dropRules makes the next check load the shared rules again. It is called
+// after every change to them.
+func (p *PermissionService) dropRules() {
+	p.mu.Lock()
+	p.rules = nil
+	p.mu.Unlock()
+}
+
+// isCategoryModerator reports whether the user moderates the category or
+// one of its ancestors.
+func isCategoryModerator(c models.Category, byID map[int]models.Category, moderates map[int]bool) bool {
+	for {
+		if moderates[c.ID] {
+			return true
+		}
+		if c.ParentID == 0 {
+			return false
+		}
+		c = byID[c.ParentID]
+	}
+}
+
+func (p *PermissionService) IsAdmin(userID int) bool {
+	if userID == 0 {
+		return false
+	}
+
+	group, err := p.repo.GetGroupByName(adminGroup)
+	if err != nil {
+		return false
+	}
+
+	groupIDs, err := p.repo.GetUserGroupIDs(userID)
+	if err != nil {
+		return false
+	}
+	for _, id := range groupIDs {
+		if id == group.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsModerator reports whether the user moderates at least one category.
+func (p *PermissionService) IsModerator(userID int) bool {
+	if userID == 0 {
+		return false
+	}
+
+	acc, err := p.accessFor(userID)
+	if err != nil {
+		return false
+	}
+	for _, ok := range acc.moderate {
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HiddenCategories lists the categories the user is not allowed to read.
+func (p *PermissionService) HiddenCategories(userID int) ([]string, error) {
+	acc, err := p.accessFor(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: hidden categories: %w", err)
+	}
+
+	var hidden []string
+	for name, ok := range acc.read {
+		if !ok {
+			hidden = append(hidden, name)
+		}
+	}
+	return hidden, nil
+}
+
+// CanRead reports whether the user may read a post filed under the given
+// categories. A post is readable only when every one of its categories is.
+func (p *PermissionService) CanRead(userID int, categories []string) (bool, error) {
+	acc, err := p.accessFor(userID)
+	if err != nil {
+		return false, fmt.Errorf("service: can read: %w", err)
+	}
+
+	for _, category := range categories {
+		if ok, known := acc.read[category]; known && !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (p *PermissionService) CanPost(userID int, category string) (bool, error) {
+	acc, err := p.accessFor(userID)
+	if err != nil {
+		return false, fmt.Errorf("service: can post: %w", err)
+	}
+
+	if ok, known := acc.post[category]; known {
+		return ok, nil
+	}
+	return userID != 0, nil
+}
+
+func (p *PermissionService) CanModerate(userID int, category string) (bool, error) {
+	acc, err := p.accessFor(userID)
+	if err != nil {
+		return false, fmt.Errorf("service: can moderate: %w", err)
+	}
+	return acc.moderate[category], nil
+}
+
+// CanModeratePost reports whether the user moderates at least one of the
+// categories of a post. Administrators moderate every post.
+func (p *PermissionService) CanModeratePost(userID int, categories []string) bool {
+	if userID == 0 {
+		return false
+	}
+	if p.IsAdmin(userID) {
+		return true
+	}
+
+	acc, err := p.accessFor(userID)
+	if err != nil {
+		return false
+	}
+	for _, category := range categories {
+		if acc.moderate[category] {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PermissionService) GetGroups() ([]models.Group, error) {
+	groups, err := p.repo.GetGroups()
+	if err != nil {
+		return nil, fmt.Errorf("service: get groups: %w", err)
+	}
+
+	for i := range groups {
+		groups[i].Members, err = p.repo.GetGroupMembers(groups[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("service: get groups: %w", err)
+		}
+	}
+	return groups, nil
+}
+
+func (p *PermissionService) CreateGroup(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 50 {
+		return fmt.Errorf("service: create group: %w", ErrInvalidGroup)
+	}
+	if err := p.repo.CreateGroup(name); err != nil {
+		return err
+	}
+	p.dropRules()
+	return nil
+}
+
+func (p *PermissionService) AddGroupMember(groupID int, username string) error {
+	user, err := p.users.GetUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return fmt.Errorf("service: add group member: %w", ErrUserNotFound)
+	}
+	return p.repo.AddUserToGroup(user.ID, groupID)
+}
+
+func (p *PermissionService) RemoveGroupMember(groupID, userID int) error {
+	return p.repo.RemoveUserFromGroup(userID, groupID)
+}
+
+func (p *PermissionService) GetCategoryPermissions() ([]models.CategoryPermission, error) {
+	return p.repo.GetCategoryPermissions()
+}
+
+func (p *PermissionService) SetCategoryPermission(perm models.CategoryPermission) error {
+	if err := p.repo.SetCategoryPermission(perm); err != nil {
+		return err
+	}
+	p.dropRules()
+	return nil
+}
+
+func (p *PermissionService) DeleteCategoryPermission(categoryID, groupID int) error {
+	if err := p.repo.DeleteCategoryPermission(categoryID, groupID); err != nil {
+		return err
+	}
+	p.dropRules()
+	return nil
+}
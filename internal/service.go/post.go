@@ -5,74 +5,173 @@ import (
 	"fmt"
 	"forum/internal/models"
 	"forum/internal/repository"
+	"html/template"
+	"log"
 	"strings"
+	"time"
 )
 
-var ErrInvalidPost = errors.New("invalid post")
+var (
+	ErrInvalidPost     = errors.New("invalid post")
+	ErrPostNotFound    = errors.New("post not found")
+	ErrInvalidSchedule = errors.New("the publishing time must be in the future")
+)
 
 type PostItem interface {
-	CreatePost(post *models.Post) error
-	GetAllPosts() (posts []models.Post, err error)
-	GetPostsByCategory(category string) ([]models.Post, error)
+	CreatePost(post *models.Post, images [][]byte, files []AttachmentFile) error
+	GetAllPosts(userID int) (posts []models.Post, err error)
+	GetPostsByCategory(category string, userID int) ([]models.Post, error)
+	GetUnansweredPosts(category string, userID int) ([]models.Post, error)
+	GetPostsByTag(tag string, userID int) ([]models.Post, error)
 	GetCreatedPosts(userID int) ([]models.Post, error)
-	GetLikedPosts(username string) ([]models.Post, error)
-	GetPostByID(id int) (models.Post, error)
-	UpdatePost(id, like, dislike int, title, content string) error
-	DeletePost(id int) error
-	LikePost(username string, postid int) error
-	DisLikePost(username string, postid int) error
+	GetUserPosts(authorID, viewerID int) ([]models.Post, error)
+	GetLikedPosts(user models.User) ([]models.Post, error)
+	GetPostByID(id, userID int) (models.Post, error)
+	CanReadPost(id, userID int) (bool, error)
+	CanEditPost(userID int, post models.Post) bool
+	UpdatePost(id, editorID int, title, content, reason string) error
+	DeletePost(id, userID int, reason string) error
+	GetDrafts(userID int) ([]models.Post, error)
+	SetPostStatus(id, userID int, status string, publishAt time.Time) error
+	PublishDue() error
+	PublishEvery(interval time.Duration)
+	LikePost(userID, postid int) error
+	DisLikePost(userID, postid int) error
 }
 
 type PostService struct {
-	repo repository.PostItem
+	repo          repository.PostItem
+	perm          Permission
+	tags          Tag
+	images        Image
+	attachments   Attachment
+	revisions     Revision
+	notifications Notification
+	reactions     Reaction
+	reputation    Reputation
+	badges        Badge
 }
 
-func NewPostService(repo repository.PostItem) *PostService {
-	return &PostService{repo: repo}
+func NewPostService(repo repository.PostItem, perm Permission, tags Tag, images Image, attachments Attachment, revisions Revision, notifications Notification, reactions Reaction, reputation Reputation, badges Badge) *PostService {
+	return &PostService{repo: repo, perm: perm, tags: tags, images: images, attachments: attachments, revisions: revisions, notifications: notifications, reactions: reactions, reputation: reputation, badges: badges}
 }
 
-func (p *PostService) CreatePost(post *models.Post) error {
+// CreatePost stores the post together with the uploaded images and files.
+// Uploads are validated before the post is written and stored in the same
+// transaction, so a post is never left behind without them.
+func (p *PostService) CreatePost(post *models.Post, images [][]byte, files []AttachmentFile) error {
 	post.Category = strings.Split(post.Category[0], ",")
 
 	if err := isValidPost(post); err != nil {
 		return err
 	}
 
-	return p.repo.CreatePost(post)
-}
+	if err := isValidStatus(post.Status, post.PublishAt); err != nil {
+		return fmt.Errorf("service: create post: %w", err)
+	}
+	if post.Status == "" {
+		post.Status = models.PostPublished
+	}
+	post.CreatedAt = time.Now()
+	post.UpdatedAt = post.CreatedAt
 
-func (p *PostService) GetAllPosts() ([]models.Post, error) {
-	posts, err := p.repo.GetAllPosts()
+	tags, err := normalizeTags(strings.Join(post.Tags, ","))
 	if err != nil {
-		return []models.Post{}, err
+		return fmt.Errorf("service: create post: %w: %v", ErrInvalidPost, err)
 	}
+	post.Tags = tags
 
-	for i := range posts {
-		category, err := p.repo.GetCategoriesByPostID(posts[i].Id)
+	mentioned, err := p.notifications.MentionedUsers(post.Content)
+	if err != nil {
+		return err
+	}
+	post.ContentHTML = template.HTML(renderMarkdown(post.Content, true, userNames(mentioned)))
+
+	for _, category := range post.Category {
+		ok, err := p.perm.CanPost(post.UserID, category)
 		if err != nil {
-			return nil, fmt.Errorf("service: get all post: %w", err)
+			return fmt.Errorf("service: create post: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("service: create post: %w", ErrPermissionDenied)
 		}
-		posts[i].Category = category
 	}
 
-	return posts, nil
+	if err := p.canCreateTags(post.UserID, post.Tags); err != nil {
+		return fmt.Errorf("service: create post: %w", err)
+	}
+
+	uploads, err := p.images.PrepareImages(images)
+	if err != nil {
+		return err
+	}
+
+	attachments, err := p.attachments.PrepareAttachments(post.UserID, files)
+	if err != nil {
+		return err
+	}
+
+	uploaded, err := p.attachments.NewFiles(post.UserID, uploads, attachments)
+	if err != nil {
+		return err
+	}
+
+	if err := p.repo.CreatePost(post, uploaded); err != nil {
+		return quotaError(err, uploaded)
+	}
+
+	// The post is there by now, so failing to notify must not fail it.
+	if err := p.notifications.NotifyMentions(post.UserID, mentioned, post.Id, 0); err != nil {
+		log.Printf("notifications: %v", err)
+	}
+
+	if post.Status == models.PostPublished {
+		p.badges.Evaluate(models.Event{Kind: models.EventPostPublished, UserID: post.UserID})
+	}
+	return nil
 }
 
-func (p *PostService) GetPostsByCategory(category string) ([]models.Post, error) {
+func (p *PostService) GetAllPosts(userID int) ([]models.Post, error) {
+	posts, err := p.repo.GetAllPosts()
+	if err != nil {
+		return []models.Post{}, err
+	}
+
+	return p.readablePosts(posts, userID)
+}
+
+func (p *PostService) GetPostsByCategory(category string, userID int) ([]models.Post, error) {
 	posts, err := p.repo.GetPostsByCategory(category)
 	if err != nil {
 		return []models.Post{}, err
 	}
 
-	for i := range posts {
-		category, err := p.repo.GetCategoriesByPostID(posts[i].Id)
-		if err != nil {
-			return nil, fmt.Errorf("service: get all post: %w", err)
-		}
-		posts[i].Category = category
+	return p.readablePosts(posts, userID)
+}
+
+// GetUnansweredPosts returns the posts of the category that have no
+// accepted answer.
+func (p *PostService) GetUnansweredPosts(category string, userID int) ([]models.Post, error) {
+	posts, err := p.repo.GetUnansweredPostsByCategory(category)
+	if err != nil {
+		return []models.Post{}, err
 	}
 
-	return posts, nil
+	return p.readablePosts(posts, userID)
+}
+
+func (p *PostService) GetPostsByTag(name string, userID int) ([]models.Post, error) {
+	tag, err := p.tags.GetTag(name)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := p.repo.GetPostsByTag(tag.ID)
+	if err != nil {
+		return []models.Post{}, err
+	}
+
+	return p.readablePosts(posts, userID)
 }
 
 func (p *PostService) GetCreatedPosts(userID int) ([]models.Post, error) {
@@ -81,37 +180,101 @@ func (p *PostService) GetCreatedPosts(userID int) ([]models.Post, error) {
 		return []models.Post{}, err
 	}
 
-	for i := range posts {
-		category, err := p.repo.GetCategoriesByPostID(posts[i].Id)
-		if err != nil {
-			return nil, fmt.Errorf("service: get all post: %w", err)
-		}
-		posts[i].Category = category
+	return p.readablePosts(posts, userID)
+}
+
+// GetUserPosts returns the published posts of the author the viewer is
+// allowed to read.
+func (p *PostService) GetUserPosts(authorID, viewerID int) ([]models.Post, error) {
+	posts, err := p.repo.GetCreatedPosts(authorID)
+	if err != nil {
+		return []models.Post{}, err
 	}
 
-	return posts, nil
+	return p.readablePosts(posts, viewerID)
 }
 
-func (p *PostService) GetLikedPosts(username string) ([]models.Post, error) {
-	posts, err := p.repo.GetLikedPosts(username)
+func (p *PostService) GetLikedPosts(user models.User) ([]models.Post, error) {
+	posts, err := p.repo.GetLikedPosts(user.ID)
 	if err != nil {
 		return []models.Post{}, err
 	}
 
-	for i := range posts {
-		category, err := p.repo.GetCategoriesByPostID(posts[i].Id)
-		if err != nil {
-			return nil, fmt.Errorf("service: get all post: %w", err)
+	return p.readablePosts(posts, user.ID)
+}
+
+// GetPostByID returns ErrPostNotFound for posts the user is not allowed to
+// read, so restricted posts look exactly like missing ones.
+func (p *PostService) GetPostByID(id, userID int) (posts models.Post, err error) {
+	post, err := p.readablePost(id, userID)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	post.Tags, err = p.tags.GetPostTags(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	post.Images, err = p.images.GetPostImages(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	post.Attachments, err = p.attachments.GetPostAttachments(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	reactions, err := p.reactions.GetReactions(models.TargetPost, []int{id})
+	if err != nil {
+		return models.Post{}, err
+	}
+	post.Reactions = reactions[id]
+
+	revisions, err := p.revisions.GetRevisions(id)
+	if err != nil {
+		return models.Post{}, err
+	}
+	if len(revisions) > 1 {
+		post.Edited = &revisions[len(revisions)-1]
+	}
+
+	var fresh bool
+	if post.ContentHTML, fresh, err = cachedHTML(string(post.ContentHTML), post.Content, true, p.notifications); err != nil {
+		return models.Post{}, err
+	}
+	if !fresh {
+		if err = p.repo.SetPostHTML(id, string(post.ContentHTML)); err != nil {
+			return models.Post{}, err
 		}
-		posts[i].Category = category
 	}
-	return posts, nil
+
+	return post, nil
 }
 
-func (p *PostService) GetPostByID(id int) (posts models.Post, err error) {
+// CanReadPost reports whether GetPostByID would show the post to the
+// user, without loading everything the post page needs.
+func (p *PostService) CanReadPost(id, userID int) (bool, error) {
+	if _, err := p.readablePost(id, userID); err != nil {
+		if errors.Is(err, ErrPostNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// readablePost loads the post with its categories. Posts in the trash,
+// drafts of others and posts the user may not read are reported as
+// ErrPostNotFound.
+func (p *PostService) readablePost(id, userID int) (models.Post, error) {
 	post, err := p.repo.GetPostByID(id)
 	if err != nil {
-		return models.Post{}, err
+		return models.Post{}, fmt.Errorf("service: get post: %w: %v", ErrPostNotFound, err)
+	}
+	if post.Deleted != nil || (post.Status != models.PostPublished && post.UserID != userID) {
+		return models.Post{}, fmt.Errorf("service: get post: %w", ErrPostNotFound)
 	}
 
 	post.Category, err = p.repo.GetCategoriesByPostID(id)
@@ -119,34 +282,87 @@ func (p *PostService) GetPostByID(id int) (posts models.Post, err error) {
 		return models.Post{}, err
 	}
 
+	ok, err := p.perm.CanRead(userID, post.Category)
+	if err != nil {
+		return models.Post{}, err
+	}
+	if !ok {
+		return models.Post{}, fmt.Errorf("service: get post: %w", ErrPostNotFound)
+	}
 	return post, nil
 }
 
-func (p *PostService) LikePost(username string, postid int) error {
-	if err := p.repo.HasUserLiked(username, postid); err != nil {
-		if err = p.repo.HasUserDislike(username, postid); err == nil {
-			if err = p.repo.RemoveDisLikePost(postid); err != nil {
-				return err
-			}
+// readablePosts loads the categories, tags and images of every post and
+// drops the posts filed under a category hidden from the user.
+func (p *PostService) readablePosts(posts []models.Post, userID int) ([]models.Post, error) {
+	hidden, err := p.perm.HiddenCategories(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: readable posts: %w", err)
+	}
+
+	isHidden := make(map[string]bool, len(hidden))
+	for _, name := range hidden {
+		isHidden[name] = true
+	}
+
+	readable := posts[:0]
+	for _, post := range posts {
+		post.Category, err = p.repo.GetCategoriesByPostID(post.Id)
+		if err != nil {
+			return nil, fmt.Errorf("service: readable posts: %w", err)
+		}
+		if inHidden(post.Category, isHidden) {
+			continue
 		}
-		return p.repo.LikePost(username, postid)
 
+		post.Tags, err = p.tags.GetPostTags(post.Id)
+		if err != nil {
+			return nil, fmt.Errorf("service: readable posts: %w", err)
+		}
+
+		post.Images, err = p.images.GetPostImages(post.Id)
+		if err != nil {
+			return nil, fmt.Errorf("service: readable posts: %w", err)
+		}
+		readable = append(readable, post)
 	}
 
-	return p.repo.RemoveLikePost(postid)
+	return readable, nil
 }
 
-func (p *PostService) DisLikePost(username string, postid int) error {
-	if err := p.repo.HasUserDislike(username, postid); err != nil {
-		if err := p.repo.HasUserLiked(username, postid); err == nil {
-			if err = p.repo.RemoveLikePost(postid); err != nil {
-				return err
-			}
+func inHidden(categories []string, hidden map[string]bool) bool {
+	for _, category := range categories {
+		if hidden[category] {
+			return true
 		}
-		return p.repo.DisLikePost(username, postid)
+	}
+	return false
+}
+
+// LikePost likes the post, or takes the like back when the user liked it
+// already. A dislike of the user turns into the like.
+func (p *PostService) LikePost(userID, postid int) error {
+	return p.vote(userID, postid, models.ReactionLike)
+}
 
+// DisLikePost is LikePost for dislikes.
+func (p *PostService) DisLikePost(userID, postid int) error {
+	return p.vote(userID, postid, models.ReactionDislike)
+}
+
+// vote toggles the like or dislike of the user and updates the reputation
+// of the author of the post to match the vote the user is left with.
+func (p *PostService) vote(userID, postID int, kind string) error {
+	post, err := p.readablePost(postID, userID)
+	if err != nil {
+		return err
 	}
-	return p.repo.RemoveDisLikePost(postid)
+
+	if err := p.reputation.Vote(userID, post.UserID, models.TargetPost, postID, kind); err != nil {
+		return err
+	}
+	p.badges.Evaluate(models.Event{Kind: models.EventVoteReceived, UserID: post.UserID})
+	return nil
 }
 
 func isValidPost(post *models.Post) error {
@@ -189,7 +405,7 @@ func isValidPost(post *models.Post) error {
 	post.Content = strings.Trim(post.Content, " \n\r")
 
 	for _, char := range post.Content {
-		if (char != 13 && char != 10) && (char < 32 || char > 126) {
+		if (char != 13 && char != 10 && char != 9) && (char < 32 || char > 126) {
 			return ErrInvalidPost
 		}
 	}
@@ -201,10 +417,231 @@ func isValidPost(post *models.Post) error {
 	return nil
 }
 
-func (p *PostService) UpdatePost(id, like, dislike int, title, content string) error {
-	return p.repo.UpdatePost(id, like, dislike, title, content)
+// canCreateTags returns ErrPermissionDenied when one of the tags does not
+// exist yet and the user may not create tags. Moderators and users with
+// enough reputation may.
+func (p *PostService) canCreateTags(userID int, tags []string) error {
+	if len(tags) == 0 || p.perm.IsModerator(userID) || p.reputation.HasPrivilege(userID, models.PrivilegeCreateTags) {
+		return nil
+	}
+
+	for _, tag := range tags {
+		if _, err := p.tags.GetTag(tag); errors.Is(err, ErrTagNotFound) {
+			return fmt.Errorf("%w: creating the tag %q needs more reputation", ErrPermissionDenied, tag)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (p *PostService) DeletePost(id int) error {
-	return p.repo.DeletePost(id)
+// CanEditPost reports whether the user may edit the post: its author,
+// its moderators and users with enough reputation may.
+func (p *PostService) CanEditPost(userID int, post models.Post) bool {
+	if userID == 0 {
+		return false
+	}
+	return post.UserID == userID || p.perm.CanModeratePost(userID, post.Category) || p.reputation.HasPrivilege(userID, models.PrivilegeEditPosts)
+}
+
+// UpdatePost saves an edit and records it as a new revision. Saving an
+// unchanged post does not add a revision.
+func (p *PostService) UpdatePost(id, editorID int, title, content, reason string) error {
+	post, err := p.repo.GetPostByID(id)
+	if err != nil {
+		return fmt.Errorf("service: update post: %w: %v", ErrPostNotFound, err)
+	}
+	if post.Deleted != nil {
+		return fmt.Errorf("service: update post: %w", ErrPostNotFound)
+	}
+
+	if post.Category, err = p.repo.GetCategoriesByPostID(id); err != nil {
+		return err
+	}
+	if !p.CanEditPost(editorID, post) {
+		return fmt.Errorf("service: update post: %w", ErrPermissionDenied)
+	}
+
+	title, content, reason = strings.Trim(title, " \n\r"), strings.Trim(content, " \n\r"), strings.TrimSpace(reason)
+	if err := isValidEdit(title, content, reason); err != nil {
+		return fmt.Errorf("service: update post: %w", err)
+	}
+
+	if title == post.Title && content == post.Content {
+		return nil
+	}
+
+	mentioned, err := p.notifications.MentionedUsers(content)
+	if err != nil {
+		return err
+	}
+
+	revision := &models.PostRevision{
+		PostID:    id,
+		EditorID:  editorID,
+		CreatedAt: time.Now(),
+		Title:     title,
+		Content:   content,
+		Reason:    reason,
+	}
+	return p.repo.UpdatePost(revision, renderMarkdown(content, true, userNames(mentioned)))
+}
+
+// isValidEdit applies the title and content rules of isValidPost to an
+// edit and limits the length of the edit reason.
+func isValidEdit(title, content, reason string) error {
+	if title == "" || len(title) > 100 || content == "" || len(content) > 1500 || len(reason) > maxRevisionReason {
+		return ErrInvalidPost
+	}
+
+	for _, char := range title + reason {
+		if char < 32 || char > 126 {
+			return ErrInvalidPost
+		}
+	}
+
+	for _, char := range content {
+		if (char != 13 && char != 10 && char != 9) && (char < 32 || char > 126) {
+			return ErrInvalidPost
+		}
+	}
+	return nil
+}
+
+// DeletePost moves the post to the trash. Authors may delete their own
+// posts, moderators any post in their categories.
+func (p *PostService) DeletePost(id, userID int, reason string) error {
+	post, err := p.GetPostByID(id, userID)
+	if err != nil {
+		return err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxDeleteReason {
+		return fmt.Errorf("service: delete post: %w", ErrInvalidPost)
+	}
+
+	if post.UserID != userID && !p.perm.CanModeratePost(userID, post.Category) {
+		return fmt.Errorf("service: delete post: %w", ErrPermissionDenied)
+	}
+
+	return p.repo.DeletePost(id, userID, reason, time.Now())
+}
+
+// GetDrafts returns the drafts and scheduled posts of the user.
+func (p *PostService) GetDrafts(userID int) ([]models.Post, error) {
+	posts, err := p.repo.GetDraftPosts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		if posts[i].Category, err = p.repo.GetCategoriesByPostID(posts[i].Id); err != nil {
+			return nil, fmt.Errorf("service: get drafts: %w", err)
+		}
+	}
+	return posts, nil
+}
+
+// SetPostStatus publishes, schedules or unpublishes a post of the user.
+// publishAt is only used for scheduled posts. Publishing dates the post
+// anew, so it shows up among the recent posts, and notifies the users
+// mentioned in it.
+func (p *PostService) SetPostStatus(id, userID int, status string, publishAt time.Time) error {
+	post, err := p.GetPostByID(id, userID)
+	if err != nil {
+		return err
+	}
+	if post.UserID != userID {
+		return fmt.Errorf("service: set post status: %w", ErrPermissionDenied)
+	}
+
+	if status == "" {
+		return fmt.Errorf("service: set post status: %w", ErrInvalidPost)
+	}
+	if err := isValidStatus(status, publishAt); err != nil {
+		return fmt.Errorf("service: set post status: %w", err)
+	}
+	switch {
+	case status == models.PostPublished && post.Status == models.PostPublished:
+		return nil
+	case status == models.PostPublished:
+		publishAt = time.Now()
+	case status != models.PostScheduled:
+		publishAt = time.Time{}
+	}
+
+	if err := p.repo.SetPostStatus(id, status, publishAt); err != nil {
+		return err
+	}
+	if status != models.PostPublished {
+		return nil
+	}
+	return p.notifyPublished(post.Id, post.UserID, post.Content)
+}
+
+// notifyPublished notifies the users mentioned in a post that was just
+// published and evaluates the badges of its author.
+func (p *PostService) notifyPublished(id, authorID int, content string) error {
+	mentioned, err := p.notifications.MentionedUsers(content)
+	if err != nil {
+		return err
+	}
+	if err := p.notifications.NotifyMentions(authorID, mentioned, id, 0); err != nil {
+		return err
+	}
+	p.badges.Evaluate(models.Event{Kind: models.EventPostPublished, UserID: authorID})
+	return nil
+}
+
+// isValidStatus accepts the empty status, which stands for published.
+func isValidStatus(status string, publishAt time.Time) error {
+	switch status {
+	case "", models.PostDraft, models.PostPublished:
+		return nil
+	case models.PostScheduled:
+		if !publishAt.After(time.Now()) {
+			return ErrInvalidSchedule
+		}
+		return nil
+	default:
+		return ErrInvalidPost
+	}
+}
+
+// PublishDue publishes the scheduled posts whose time has come and
+// notifies the users mentioned in them.
+func (p *PostService) PublishDue() error {
+	ids, err := p.repo.PublishDuePosts(time.Now())
+	if err != nil {
+		return fmt.Errorf("service: publish due posts: %w", err)
+	}
+	if len(ids) > 0 {
+		log.Printf("scheduler: published %d post(s)", len(ids))
+	}
+
+	for _, id := range ids {
+		post, err := p.repo.GetPostByID(id)
+		if err != nil {
+			return fmt.Errorf("service: publish due posts: %w", err)
+		}
+		if err := p.notifyPublished(post.Id, post.UserID, post.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishEvery runs PublishDue right away and then once per interval. It
+// never returns and is meant to run in its own goroutine.
+func (p *PostService) PublishEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.PublishDue(); err != nil {
+			log.Printf("scheduler: %v", err)
+		}
+		<-ticker.C
+	}
 }
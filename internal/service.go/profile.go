@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+type Profile interface {
+	GetProfile(username string, viewerID int) (models.Profile, error)
+}
+
+type ProfileService struct {
+	users      repository.Authorization
+	posts      PostItem
+	comments   Comment
+	reputation Reputation
+	badges     Badge
+}
+
+func NewProfileService(users repository.Authorization, posts PostItem, comments Comment, reputation Reputation, badges Badge) *ProfileService {
+	return &ProfileService{users: users, posts: posts, comments: comments, reputation: reputation, badges: badges}
+}
+
+// GetProfile returns the public profile of the user, with the posts and
+// comments the viewer is allowed to read. Private fields such as the
+// email address are left out.
+func (p *ProfileService) GetProfile(username string, viewerID int) (models.Profile, error) {
+	user, err := p.users.GetUserByUsername(username)
+	if err != nil {
+		return models.Profile{}, fmt.Errorf("service: get profile: %w: %v", ErrUserNotFound, err)
+	}
+
+	profile := models.Profile{
+		User: models.User{ID: user.ID, Username: user.Username, CreatedAt: user.CreatedAt},
+	}
+
+	if profile.Reputation, err = p.reputation.GetReputation(user.ID); err != nil {
+		return models.Profile{}, err
+	}
+
+	if profile.Privileges, err = p.reputation.GetPrivileges(user.ID); err != nil {
+		return models.Profile{}, err
+	}
+
+	if profile.Badges, err = p.badges.GetUserBadges(user.ID); err != nil {
+		return models.Profile{}, err
+	}
+
+	if profile.Posts, err = p.posts.GetUserPosts(user.ID, viewerID); err != nil {
+		return models.Profile{}, err
+	}
+
+	if profile.Comments, err = p.comments.GetUserComments(user.ID, viewerID); err != nil {
+		return models.Profile{}, err
+	}
+
+	return profile, nil
+}
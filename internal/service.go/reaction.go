@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+)
+
+var ErrInvalidReaction = errors.New("invalid reaction")
+
+// reactionsPerPage is how many users a page of reactions lists.
+const reactionsPerPage = 50
+
+type Reaction interface {
+	Emojis() []string
+	ToggleReaction(userID int, target string, targetID int, kind string) error
+	GetReactions(target string, targetIDs []int) (map[int][]models.ReactionCount, error)
+	GetVotes(userID int, target string, targetIDs []int) (map[int]string, error)
+	GetReactionPage(target string, targetID int, kind string, page, userID int) (models.ReactionPage, error)
+}
+
+type ReactionService struct {
+	repo   repository.Reaction
+	emojis []string
+}
+
+func NewReactionService(repo repository.Reaction, emojis []string) *ReactionService {
+	return &ReactionService{repo: repo, emojis: emojis}
+}
+
+// Emojis returns the emoji users can react with, in the order they are
+// offered.
+func (r *ReactionService) Emojis() []string {
+	return r.emojis
+}
+
+// ToggleReaction adds the reaction of the user to the post or comment, or
+// takes it back when the user reacted so already. The kind is a like, a
+// dislike or one of the emoji.
+func (r *ReactionService) ToggleReaction(userID int, target string, targetID int, kind string) error {
+	if !r.isValid(target, kind) {
+		return fmt.Errorf("service: toggle reaction: %w", ErrInvalidReaction)
+	}
+	return r.repo.ToggleReaction(userID, target, targetID, kind)
+}
+
+// GetReactions sums up the emoji reactions to the targets by target id.
+// Emoji come in the order they are offered; those no longer offered are
+// left out.
+func (r *ReactionService) GetReactions(target string, targetIDs []int) (map[int][]models.ReactionCount, error) {
+	reactions, err := r.repo.GetReactions(target, targetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[int]map[string][]string)
+	for _, reaction := range reactions {
+		if users[reaction.TargetID] == nil {
+			users[reaction.TargetID] = make(map[string][]string)
+		}
+		users[reaction.TargetID][reaction.Kind] = append(users[reaction.TargetID][reaction.Kind], reaction.Username)
+	}
+
+	counts := make(map[int][]models.ReactionCount, len(users))
+	for id, byEmoji := range users {
+		for _, emoji := range r.emojis {
+			if len(byEmoji[emoji]) > 0 {
+				counts[id] = append(counts[id], models.ReactionCount{Emoji: emoji, Users: byEmoji[emoji]})
+			}
+		}
+	}
+	return counts, nil
+}
+
+// GetVotes returns the like or dislike of the user by target id, for the
+// targets the user voted on.
+func (r *ReactionService) GetVotes(userID int, target string, targetIDs []int) (map[int]string, error) {
+	votes := make(map[int]string)
+	if userID == 0 {
+		return votes, nil
+	}
+
+	reactions, err := r.repo.GetUserReactions(userID, target, targetIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, reaction := range reactions {
+		if reaction.Kind == models.ReactionLike || reaction.Kind == models.ReactionDislike {
+			votes[reaction.TargetID] = reaction.Kind
+		}
+	}
+	return votes, nil
+}
+
+// GetReactionPage returns a page of the users who reacted to the post or
+// comment with the given kind, likes for an empty kind. The tabs list
+// likes and dislikes followed by the emoji anyone reacted with, marking
+// those of the user. Pages past the last one are empty.
+func (r *ReactionService) GetReactionPage(target string, targetID int, kind string, page, userID int) (models.ReactionPage, error) {
+	if kind == "" {
+		kind = models.ReactionLike
+	}
+	if !r.isValid(target, kind) {
+		return models.ReactionPage{}, fmt.Errorf("service: get reaction page: %w", ErrInvalidReaction)
+	}
+
+	counts, err := r.repo.CountReactions(target, targetID)
+	if err != nil {
+		return models.ReactionPage{}, err
+	}
+
+	own := make(map[string]bool)
+	if userID != 0 {
+		reactions, err := r.repo.GetUserReactions(userID, target, []int{targetID})
+		if err != nil {
+			return models.ReactionPage{}, err
+		}
+		for _, reaction := range reactions {
+			own[reaction.Kind] = true
+		}
+	}
+
+	result := models.ReactionPage{
+		Target:   target,
+		TargetID: targetID,
+		Kind:     kind,
+		Page:     page,
+		Pages:    (counts[kind] + reactionsPerPage - 1) / reactionsPerPage,
+	}
+	if page < 1 {
+		result.Page = 1
+	}
+
+	// Likes and dislikes always get a tab, the emoji only once used.
+	for i, tab := range append([]string{models.ReactionLike, models.ReactionDislike}, r.emojis...) {
+		if i < 2 || counts[tab] > 0 || tab == kind {
+			result.Tabs = append(result.Tabs, models.ReactionTab{Kind: tab, Count: counts[tab], Own: own[tab]})
+		}
+	}
+
+	// The offset of pages far past the last one would overflow.
+	if result.Page > result.Pages {
+		return result, nil
+	}
+
+	if result.Reactions, err = r.repo.GetReactionUsers(target, targetID, kind, reactionsPerPage, (result.Page-1)*reactionsPerPage); err != nil {
+		return models.ReactionPage{}, err
+	}
+	return result, nil
+}
+
+// isValid reports whether the kind is a like, a dislike or one of the
+// emoji, and the target a post or a comment.
+func (r *ReactionService) isValid(target, kind string) bool {
+	if target != models.TargetPost && target != models.TargetComment {
+		return false
+	}
+	return kind == models.ReactionLike || kind == models.ReactionDislike || r.isEmoji(kind)
+}
+
+func (r *ReactionService) isEmoji(kind string) bool {
+	for _, emoji := range r.emojis {
+		if emoji == kind {
+			return true
+		}
+	}
+	return false
+}
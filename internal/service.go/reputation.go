@@ -0,0 +1,133 @@
+package service
+
+import (
+	"forum/internal/config"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"math"
+	"time"
+)
+
+type Reputation interface {
+	Vote(actorID, authorID int, target string, targetID int, kind string) error
+	ScorePastVotes() error
+	GetReputation(userID int) (int, error)
+	HasPrivilege(userID int, privilege string) bool
+	GetPrivileges(userID int) ([]models.Privilege, error)
+}
+
+type ReputationService struct {
+	repo repository.Reputation
+	cfg  config.Reputation
+}
+
+func NewReputationService(repo repository.Reputation, cfg config.Reputation) *ReputationService {
+	return &ReputationService{repo: repo, cfg: cfg}
+}
+
+// Vote toggles the like or dislike of the actor on a post or comment and
+// updates the reputation of its author, given as 0 when there is none, to
+// match the vote the actor is left with. Votes on one's own posts and
+// comments are worth nothing.
+func (r *ReputationService) Vote(actorID, authorID int, target string, targetID int, kind string) error {
+	event := models.ReputationEvent{
+		UserID:    authorID,
+		ActorID:   actorID,
+		Target:    target,
+		TargetID:  targetID,
+		Kind:      kind,
+		CreatedAt: time.Now(),
+	}
+
+	points := make(map[string]int)
+	for _, vote := range []string{models.ReactionLike, models.ReactionDislike} {
+		points[vote] = r.points(models.ReputationEvent{UserID: authorID, ActorID: actorID, Target: target, Kind: vote})
+	}
+	return r.repo.ToggleVote(event, points, r.cfg.DailyCap)
+}
+
+// ScorePastVotes scores the votes that have no reputation recorded, such
+// as those made before reputation was kept, on the days they were made.
+// It then recounts every reputation, as earlier versions kept the points
+// earned on posts and comments in the trash.
+func (r *ReputationService) ScorePastVotes() error {
+	events, err := r.repo.GetUnscoredVotes()
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now()
+		}
+		event.Points = r.points(event)
+		if err := r.repo.ScoreVote(event, r.cfg.DailyCap); err != nil {
+			return err
+		}
+	}
+	return r.repo.RecountReputation()
+}
+
+// points returns what the vote of the event is worth to the author.
+func (r *ReputationService) points(event models.ReputationEvent) int {
+	if event.ActorID == event.UserID {
+		return 0
+	}
+
+	switch {
+	case event.Target == models.TargetPost && event.Kind == models.ReactionLike:
+		return r.cfg.PostLike
+	case event.Target == models.TargetPost && event.Kind == models.ReactionDislike:
+		return -r.cfg.PostDislike
+	case event.Target == models.TargetComment && event.Kind == models.ReactionLike:
+		return r.cfg.CommentLike
+	case event.Target == models.TargetComment && event.Kind == models.ReactionDislike:
+		return -r.cfg.CommentDislike
+	}
+	return 0
+}
+
+func (r *ReputationService) GetReputation(userID int) (int, error) {
+	return r.repo.GetReputation(userID)
+}
+
+// HasPrivilege reports whether the reputation of the user reaches the
+// threshold of the privilege.
+func (r *ReputationService) HasPrivilege(userID int, privilege string) bool {
+	if userID == 0 {
+		return false
+	}
+
+	reputation, err := r.repo.GetReputation(userID)
+	if err != nil {
+		return false
+	}
+	return reputation >= r.threshold(privilege)
+}
+
+// GetPrivileges lists the privileges with their thresholds, marking those
+// the user has unlocked.
+func (r *ReputationService) GetPrivileges(userID int) ([]models.Privilege, error) {
+	reputation, err := r.repo.GetReputation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var privileges []models.Privilege
+	for _, name := range []string{models.PrivilegeCreateTags, models.PrivilegeEditPosts} {
+		threshold := r.threshold(name)
+		privileges = append(privileges, models.Privilege{Name: name, Threshold: threshold, Unlocked: reputation >= threshold})
+	}
+	return privileges, nil
+}
+
+func (r *ReputationService) threshold(privilege string) int {
+	switch privilege {
+	case models.PrivilegeCreateTags:
+		return r.cfg.CreateTags
+	case models.PrivilegeEditPosts:
+		return r.cfg.EditPosts
+	}
+	// Unknown privileges are never unlocked.
+	return math.MaxInt
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"strings"
+	"time"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+const maxRevisionReason = 200
+
+type Revision interface {
+	GetRevisions(postID int) ([]models.PostRevision, error)
+	GetRevisionDiff(postID, fromID, toID int) (models.RevisionDiff, error)
+	CanRollback(userID int, post models.Post) bool
+	RollbackPost(post models.Post, revisionID, userID int) error
+}
+
+type RevisionService struct {
+	repo          repository.Revision
+	posts         repository.PostItem
+	perm          Permission
+	notifications Notification
+}
+
+func NewRevisionService(repo repository.Revision, posts repository.PostItem, perm Permission, notifications Notification) *RevisionService {
+	return &RevisionService{repo: repo, posts: posts, perm: perm, notifications: notifications}
+}
+
+func (r *RevisionService) GetRevisions(postID int) ([]models.PostRevision, error) {
+	revisions, err := r.repo.GetRevisionsByPostID(postID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// GetRevisionDiff compares two revisions of the post. A zero id selects
+// the latest revision for toID and the one before it for fromID.
+func (r *RevisionService) GetRevisionDiff(postID, fromID, toID int) (models.RevisionDiff, error) {
+	revisions, err := r.GetRevisions(postID)
+	if err != nil {
+		return models.RevisionDiff{}, err
+	}
+	if len(revisions) == 0 {
+		return models.RevisionDiff{}, ErrRevisionNotFound
+	}
+
+	to := revisions[len(revisions)-1]
+	from := to
+	if len(revisions) > 1 {
+		from = revisions[len(revisions)-2]
+	}
+
+	if toID != 0 {
+		if to, err = findRevision(revisions, toID); err != nil {
+			return models.RevisionDiff{}, err
+		}
+	}
+	if fromID != 0 {
+		if from, err = findRevision(revisions, fromID); err != nil {
+			return models.RevisionDiff{}, err
+		}
+	}
+
+	return models.RevisionDiff{
+		From:    from,
+		To:      to,
+		Title:   diffLines(from.Title, to.Title),
+		Content: diffLines(from.Content, to.Content),
+	}, nil
+}
+
+func findRevision(revisions []models.PostRevision, id int) (models.PostRevision, error) {
+	for _, revision := range revisions {
+		if revision.ID == id {
+			return revision, nil
+		}
+	}
+	return models.PostRevision{}, ErrRevisionNotFound
+}
+
+// CanRollback reports whether the user moderates one of the categories of
+// the post.
+func (r *RevisionService) CanRollback(userID int, post models.Post) bool {
+	return r.perm.CanModeratePost(userID, post.Category)
+}
+
+// RollbackPost restores the title and content of an earlier revision. The
+// rollback is recorded as a new revision, so it can be undone as well.
+func (r *RevisionService) RollbackPost(post models.Post, revisionID, userID int) error {
+	if !r.CanRollback(userID, post) {
+		return fmt.Errorf("service: rollback post: %w", ErrPermissionDenied)
+	}
+
+	revisions, err := r.GetRevisions(post.Id)
+	if err != nil {
+		return err
+	}
+
+	revision, err := findRevision(revisions, revisionID)
+	if err != nil {
+		return err
+	}
+
+	if revision.Title == post.Title && revision.Content == post.Content {
+		return nil
+	}
+
+	mentioned, err := r.notifications.MentionedUsers(revision.Content)
+	if err != nil {
+		return err
+	}
+
+	rollback := &models.PostRevision{
+		PostID:    post.Id,
+		EditorID:  userID,
+		CreatedAt: time.Now(),
+		Title:     revision.Title,
+		Content:   revision.Content,
+		Reason:    fmt.Sprintf("Rolled back to revision %d", revision.Number),
+	}
+	return r.posts.UpdatePost(rollback, renderMarkdown(revision.Content, true, userNames(mentioned)))
+}
+
+// maxDiffCells bounds the table diffLines fills in, which has a cell for
+// every pair of changed old and new lines. Larger changes are shown as
+// the old lines removed and the new ones added.
+const maxDiffCells = 1 << 20
+
+// diffLines computes a line-level diff of a and b from their longest
+// common subsequence of lines.
+func diffLines(a, b string) []models.DiffLine {
+	oldLines := splitLines(a)
+	newLines := splitLines(b)
+
+	// Lines both versions start or end with are equal in any diff, which
+	// leaves only the lines in between to compare.
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var diff []models.DiffLine
+	for i := 0; i < prefix; i++ {
+		diff = append(diff, models.DiffLine{Kind: "equal", OldLine: i + 1, NewLine: i + 1, Text: oldLines[i]})
+	}
+	diff = diffChanged(diff, oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix], prefix)
+	for i := suffix; i > 0; i-- {
+		diff = append(diff, models.DiffLine{Kind: "equal", OldLine: len(oldLines) - i + 1, NewLine: len(newLines) - i + 1, Text: oldLines[len(oldLines)-i]})
+	}
+	return diff
+}
+
+// diffChanged appends the diff of the lines between the common start and
+// end of two versions, offset lines into both.
+func diffChanged(diff []models.DiffLine, oldLines, newLines []string, offset int) []models.DiffLine {
+	if (len(oldLines)+1)*(len(newLines)+1) > maxDiffCells {
+		for i, line := range oldLines {
+			diff = append(diff, models.DiffLine{Kind: "delete", OldLine: offset + i + 1, Text: line})
+		}
+		for j, line := range newLines {
+			diff = append(diff, models.DiffLine{Kind: "insert", NewLine: offset + j + 1, Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// oldLines[i:] and newLines[j:].
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			diff = append(diff, models.DiffLine{Kind: "equal", OldLine: offset + i + 1, NewLine: offset + j + 1, Text: oldLines[i]})
+			i++
+			j++
+		case j < len(newLines) && (i == len(oldLines) || lcs[i][j+1] > lcs[i+1][j]):
+			diff = append(diff, models.DiffLine{Kind: "insert", NewLine: offset + j + 1, Text: newLines[j]})
+			j++
+		default:
+			diff = append(diff, models.DiffLine{Kind: "delete", OldLine: offset + i + 1, Text: oldLines[i]})
+			i++
+		}
+	}
+	return diff
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"forum/internal/config"
 	"forum/internal/repository"
 )
 
@@ -8,12 +9,52 @@ type Service struct {
 	Authorization
 	PostItem
 	Comment
+	Category
+	Permission
+	Tag
+	Markdown
+	Image
+	Attachment
+	Revision
+	Trash
+	Blob
+	Profile
+	Notification
+	Reaction
+	Reputation
+	Badge
 }
 
-func NewService(repos *repository.Repository) *Service {
+func NewService(repos *repository.Repository, cfg config.Config) *Service {
+	permission := NewPermissionService(repos.Permission, repos.Category, repos.Authorization)
+	tags := NewTagService(repos.Tag, permission)
+	images := NewImageService(repos.Image, repos.Blobs, cfg.Blob.URLExpiry)
+	attachments := NewAttachmentService(repos.Attachment, repos.Authorization, repos.Blobs, cfg.Blob.URLExpiry, cfg.AttachmentQuota)
+	reactions := NewReactionService(repos.Reaction, cfg.Reactions)
+	reputation := NewReputationService(repos.Reputation, cfg.Reputation)
+	badges := NewBadgeService(repos.Badge)
+	notifications := NewNotificationService(repos.Notification, repos.Authorization, repos.PostItem, permission)
+	revisions := NewRevisionService(repos.Revision, repos.PostItem, permission, notifications)
+	posts := NewPostService(repos.PostItem, permission, tags, images, attachments, revisions, notifications, reactions, reputation, badges)
+	comments := NewCommentService(repos.Comment, repos.PostItem, repos.Revision, permission, attachments, notifications, reactions, reputation, badges, cfg.CommentMaxDepth, cfg.CommentsPerPage)
+
 	return &Service{
-		Authorization: NewAuthService(repos.Authorization),
-		PostItem:      NewPostService(repos.PostItem),
-		Comment:       NewCommentService(repos.Comment),
+		Authorization: NewAuthService(repos.Authorization, badges),
+		PostItem:      posts,
+		Comment:       comments,
+		Category:      NewCategoryService(repos.Category, permission),
+		Permission:    permission,
+		Tag:           tags,
+		Markdown:      NewMarkdownService(),
+		Image:         images,
+		Attachment:    attachments,
+		Revision:      revisions,
+		Trash:         NewTrashService(repos.PostItem, repos.Comment, permission, images, attachments, cfg.TrashRetention),
+		Blob:          NewBlobService(repos.Blobs),
+		Profile:       NewProfileService(repos.Authorization, posts, comments, reputation, badges),
+		Notification:  notifications,
+		Reaction:      reactions,
+		Reputation:    reputation,
+		Badge:         badges,
 	}
 }
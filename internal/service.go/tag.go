@@ -0,0 +1,192 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidTag  = errors.New("invalid tag")
+	ErrTagNotFound = errors.New("tag not found")
+)
+
+const (
+	MaxPostTags  = 5
+	maxTagLength = 30
+	tagCloudSize = 30
+	autocomplete = 10
+)
+
+type Tag interface {
+	GetTag(name string) (models.Tag, error)
+	Autocomplete(prefix string, userID int) ([]models.Tag, error)
+	GetTagCloud(userID int) ([]models.Tag, error)
+	GetPostTags(postID int) ([]string, error)
+	MergeTags(from, to string, userID int) error
+}
+
+type TagService struct {
+	repo repository.Tag
+	perm Permission
+}
+
+func NewTagService(repo repository.Tag, perm Permission) *TagService {
+	return &TagService{repo: repo, perm: perm}
+}
+
+// GetTag returns the tag with its synonyms. Looking up a synonym returns
+// the tag it was merged into.
+func (t *TagService) GetTag(name string) (models.Tag, error) {
+	name, err := normalizeTag(name)
+	if err != nil {
+		return models.Tag{}, ErrTagNotFound
+	}
+
+	tag, err := t.repo.GetTagByName(name)
+	if err != nil {
+		return models.Tag{}, ErrTagNotFound
+	}
+
+	if tag.SynonymOf != 0 {
+		if tag, err = t.repo.GetTagByID(tag.SynonymOf); err != nil {
+			return models.Tag{}, fmt.Errorf("service: get tag: %w", err)
+		}
+	}
+
+	if tag.Synonyms, err = t.repo.GetSynonyms(tag.ID); err != nil {
+		return models.Tag{}, fmt.Errorf("service: get tag: %w", err)
+	}
+	return tag, nil
+}
+
+// Autocomplete suggests tags starting with the prefix, counting only the
+// posts the user is allowed to read.
+func (t *TagService) Autocomplete(prefix string, userID int) ([]models.Tag, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return []models.Tag{}, nil
+	}
+
+	hidden, err := t.perm.HiddenCategories(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: autocomplete tags: %w", err)
+	}
+
+	tags, err := t.repo.SearchTags(prefix, hidden, autocomplete)
+	if err != nil {
+		return nil, fmt.Errorf("service: autocomplete tags: %w", err)
+	}
+	return tags, nil
+}
+
+// GetTagCloud returns the most used tags sorted by name, each with a weight
+// from 1 to 5 on a logarithmic scale. Only the posts the user is allowed
+// to read are counted.
+func (t *TagService) GetTagCloud(userID int) ([]models.Tag, error) {
+	hidden, err := t.perm.HiddenCategories(userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: get tag cloud: %w", err)
+	}
+
+	tags, err := t.repo.GetPopularTags(hidden, tagCloudSize)
+	if err != nil {
+		return nil, fmt.Errorf("service: get tag cloud: %w", err)
+	}
+
+	maxCount := 1
+	for _, tag := range tags {
+		if tag.Count > maxCount {
+			maxCount = tag.Count
+		}
+	}
+
+	for i := range tags {
+		tags[i].Weight = 1 + int(4*math.Log(float64(tags[i].Count)+1)/math.Log(float64(maxCount)+1))
+	}
+
+	sortTags(tags)
+	return tags, nil
+}
+
+func (t *TagService) GetPostTags(postID int) ([]string, error) {
+	return t.repo.GetTagsByPostID(postID)
+}
+
+func (t *TagService) MergeTags(from, to string, userID int) error {
+	if !t.perm.IsModerator(userID) {
+		return fmt.Errorf("service: merge tags: %w", ErrPermissionDenied)
+	}
+
+	source, err := t.GetTag(from)
+	if err != nil {
+		return fmt.Errorf("service: merge tags: %w", err)
+	}
+
+	target, err := t.GetTag(to)
+	if err != nil {
+		return fmt.Errorf("service: merge tags: %w", err)
+	}
+
+	if source.ID == target.ID {
+		return fmt.Errorf("service: merge tags: %w", ErrInvalidTag)
+	}
+
+	return t.repo.MergeTags(source.ID, target.ID)
+}
+
+// normalizeTags splits a comma separated list into unique normalized tags.
+func normalizeTags(raw string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(raw, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		tag, err := normalizeTag(part)
+		if err != nil {
+			return nil, err
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > MaxPostTags {
+		return nil, fmt.Errorf("service: too many tags: %w", ErrInvalidTag)
+	}
+	return tags, nil
+}
+
+// normalizeTag lowercases the tag, drops a leading "#" and joins words with
+// dashes. Only letters, digits and ".+-" are allowed so tags stay URL safe.
+func normalizeTag(raw string) (string, error) {
+	tag := strings.ToLower(strings.TrimSpace(raw))
+	tag = strings.TrimPrefix(tag, "#")
+	tag = strings.Join(strings.Fields(tag), "-")
+
+	if tag == "" || len(tag) > maxTagLength {
+		return "", fmt.Errorf("service: normalize tag: %w", ErrInvalidTag)
+	}
+
+	for _, char := range tag {
+		if !(char >= 'a' && char <= 'z' || char >= '0' && char <= '9' || strings.ContainsRune(".+-", char)) {
+			return "", fmt.Errorf("service: normalize tag: %w", ErrInvalidTag)
+		}
+	}
+	return tag, nil
+}
+
+func sortTags(tags []models.Tag) {
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+}
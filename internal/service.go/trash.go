@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/repository"
+	"log"
+	"time"
+)
+
+const maxDeleteReason = 200
+
+type Trash interface {
+	GetTrash(userID int) (models.Trash, error)
+	RestorePost(postID, userID int) error
+	RestoreComment(commentID, userID int) error
+	Purge() error
+	PurgeEvery(interval time.Duration)
+}
+
+// TrashService manages deleted posts and comments. They can be restored by
+// moderators until the retention period is over; Purge then removes them
+// for good.
+type TrashService struct {
+	posts       repository.PostItem
+	comments    repository.Comment
+	perm        Permission
+	images      Image
+	attachments Attachment
+	retention   time.Duration
+}
+
+func NewTrashService(posts repository.PostItem, comments repository.Comment, perm Permission, images Image, attachments Attachment, retention time.Duration) *TrashService {
+	return &TrashService{
+		posts:       posts,
+		comments:    comments,
+		perm:        perm,
+		images:      images,
+		attachments: attachments,
+		retention:   retention,
+	}
+}
+
+// GetTrash returns the deleted posts and comments in the categories the
+// user moderates.
+func (t *TrashService) GetTrash(userID int) (models.Trash, error) {
+	var trash models.Trash
+
+	posts, err := t.posts.GetDeletedPosts()
+	if err != nil {
+		return models.Trash{}, err
+	}
+
+	for _, post := range posts {
+		if post.Category, err = t.posts.GetCategoriesByPostID(post.Id); err != nil {
+			return models.Trash{}, fmt.Errorf("service: get trash: %w", err)
+		}
+		if !t.perm.CanModeratePost(userID, post.Category) {
+			continue
+		}
+		post.Deleted.PurgeAt = post.Deleted.At.Add(t.retention)
+		trash.Posts = append(trash.Posts, post)
+	}
+
+	comments, err := t.comments.GetDeletedComments()
+	if err != nil {
+		return models.Trash{}, err
+	}
+
+	moderated := make(map[int]bool)
+	for _, comment := range comments {
+		ok, known := moderated[comment.PostID]
+		if !known {
+			categories, err := t.posts.GetCategoriesByPostID(comment.PostID)
+			if err != nil {
+				return models.Trash{}, fmt.Errorf("service: get trash: %w", err)
+			}
+			ok = t.perm.CanModeratePost(userID, categories)
+			moderated[comment.PostID] = ok
+		}
+		if !ok {
+			continue
+		}
+		comment.Deleted.PurgeAt = comment.Deleted.At.Add(t.retention)
+		trash.Comments = append(trash.Comments, comment)
+	}
+
+	return trash, nil
+}
+
+func (t *TrashService) RestorePost(postID, userID int) error {
+	post, err := t.posts.GetPostByID(postID)
+	if err != nil || post.Deleted == nil {
+		return fmt.Errorf("service: restore post: %w", ErrPostNotFound)
+	}
+
+	categories, err := t.posts.GetCategoriesByPostID(postID)
+	if err != nil {
+		return fmt.Errorf("service: restore post: %w", err)
+	}
+	if !t.perm.CanModeratePost(userID, categories) {
+		return fmt.Errorf("service: restore post: %w", ErrPermissionDenied)
+	}
+
+	return t.posts.RestorePost(postID)
+}
+
+func (t *TrashService) RestoreComment(commentID, userID int) error {
+	comment, err := t.comments.GetCommentByID(commentID)
+	if err != nil || comment.Deleted == nil {
+		return fmt.Errorf("service: restore comment: %w", ErrCommentNotFound)
+	}
+
+	categories, err := t.posts.GetCategoriesByPostID(comment.PostID)
+	if err != nil {
+		return fmt.Errorf("service: restore comment: %w", err)
+	}
+	if !t.perm.CanModeratePost(userID, categories) {
+		return fmt.Errorf("service: restore comment: %w", ErrPermissionDenied)
+	}
+
+	return t.comments.RestoreComment(commentID)
+}
+
+// Purge removes the posts and comments that have been in the trash for
+// longer than the retention period, with everything that belongs to them.
+// Rows left behind by posts deleted before the trash existed are removed
+// as well.
+func (t *TrashService) Purge() error {
+	before := time.Now().Add(-t.retention)
+
+	postIDs, err := t.posts.GetPostsDeletedBefore(before)
+	if err != nil {
+		return fmt.Errorf("service: purge: %w", err)
+	}
+
+	orphans, err := t.posts.GetOrphanedPostIDs()
+	if err != nil {
+		return fmt.Errorf("service: purge: %w", err)
+	}
+
+	for _, id := range append(postIDs, orphans...) {
+		if err := t.purgePost(id); err != nil {
+			return err
+		}
+	}
+
+	commentIDs, err := t.comments.GetCommentsDeletedBefore(before)
+	if err != nil {
+		return fmt.Errorf("service: purge: %w", err)
+	}
+
+	for _, id := range commentIDs {
+		if err := t.attachments.DeleteCommentAttachments(id); err != nil {
+			return err
+		}
+		if err := t.comments.PurgeComment(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TrashService) purgePost(id int) error {
+	if err := t.images.DeletePostImages(id); err != nil {
+		return err
+	}
+	if err := t.attachments.DeletePostAttachments(id); err != nil {
+		return err
+	}
+	return t.posts.PurgePost(id)
+}
+
+// PurgeEvery runs Purge right away and then once per interval. It never
+// returns and is meant to run in its own goroutine.
+func (t *TrashService) PurgeEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Purge(); err != nil {
+			log.Printf("trash: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,30 @@
+// Replaces a "load more" link with the next page of comments, which ends
+// with the link to the page after it. Without the fragment the link still
+// opens that page on its own.
+document.addEventListener("click", async (event) => {
+  const link = event.target.closest("a.comment-more[data-fragment]");
+  if (!link) {
+    return;
+  }
+  event.preventDefault();
+
+  const response = await fetch(link.dataset.fragment);
+  if (!response.ok) {
+    location.href = link.href;
+    return;
+  }
+  link.outerHTML = await response.text();
+});
+
+// Permalinks point at /get-post/{id}#c{commentID}. When the comment is not
+// on the page shown, asks the server for the page or thread that has it.
+const permalink = location.hash.match(/^#c(\d+)$/);
+if (permalink && !document.getElementById("c" + permalink[1])) {
+  const params = new URLSearchParams(location.search);
+  if (!params.has("comment")) {
+    params.delete("page");
+    params.delete("thread");
+    params.set("comment", permalink[1]);
+    location.replace(location.pathname + "?" + params + location.hash);
+  }
+}
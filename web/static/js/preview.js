@@ -0,0 +1,17 @@
+// Renders the Markdown of a textarea on the server and shows the result.
+// Buttons use data-source (textarea id) and data-target (preview block id).
+document.querySelectorAll(".preview-button").forEach((button) => {
+  button.addEventListener("click", () => {
+    const source = document.getElementById(button.dataset.source);
+    const target = document.getElementById(button.dataset.target);
+    const body = new URLSearchParams();
+    body.append("content", source.value);
+
+    fetch("/preview", { method: "POST", body: body })
+      .then((response) => response.text())
+      .then((html) => {
+        target.innerHTML = html;
+        target.classList.add("preview-visible");
+      });
+  });
+});
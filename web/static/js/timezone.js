@@ -0,0 +1,15 @@
+// Fills the timezone-offset inputs of forms with datetime-local fields, so
+// the server can tell which moment the user's local time refers to.
+document.querySelectorAll('input[name="timezone-offset"]').forEach((input) => {
+  input.value = new Date().getTimezoneOffset();
+});
+
+// Suggests the timezone of the browser on the settings page.
+const detected = Intl.DateTimeFormat().resolvedOptions().timeZone;
+const suggestions = document.getElementById("timezone-detected");
+if (detected && suggestions) {
+  const option = document.createElement("option");
+  option.value = detected;
+  suggestions.appendChild(option);
+  document.getElementById("timezone-hint").textContent = "Your browser uses " + detected + ".";
+}